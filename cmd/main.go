@@ -1,50 +1,187 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"fmt"
 	"log"
 	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+
+	"tgbot/internal/config"
+	"tgbot/internal/i18n"
+	"tgbot/internal/quiz"
 	"tgbot/internal/storage"
 	"tgbot/internal/tgbot"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
-	"github.com/joho/godotenv"
 )
 
-func init() {
-	err := godotenv.Load(".env")
+var (
+	configPath  = flag.String("config", "", "YAML-файл настроек (по умолчанию CONFIG_FILE)")
+	printConfig = flag.Bool("print-config", false, "вывести действующие настройки без секретов и выйти")
+)
+
+func main() {
+	flag.Parse()
+	args := flag.Args()
+
+	// go run ./cmd graph | dot -Tpng > flow.png — схема диалога для ревью
+	if len(args) > 0 && args[0] == "graph" {
+		fmt.Print(tgbot.ConversationGraph())
+		return
+	}
+
+	cfg, err := config.Load(*configPath)
 	if err != nil {
-		log.Fatalf("Error loading .env file")
+		log.Fatalf("Config: %v", err)
+	}
+	if *printConfig {
+		out, err := cfg.Redacted().YAML()
+		if err != nil {
+			log.Fatalf("Config: %v", err)
+		}
+		fmt.Print(string(out))
+		if err := cfg.Validate(); err != nil {
+			log.Fatalf("Config is invalid:\n%v", err)
+		}
+		return
 	}
-}
 
-func main() {
-	db, err := storage.InitDB()
+	// SIGINT/SIGTERM отменяют ctx: бот дорабатывает начатое и выходит
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if len(args) > 0 && args[0] == "migrate" {
+		if err := runMigrate(ctx, cfg.Database.URL, args[1:]); err != nil {
+			log.Fatalf("migrate: %v", err)
+		}
+		return
+	}
+
+	if err := cfg.Validate(); err != nil {
+		log.Fatalf("Config is invalid:\n%v", err)
+	}
+
+	store, err := storage.InitDB(ctx, cfg.Database.URL)
 	if err != nil {
 		log.Fatalf("DB init error: %v", err)
 	}
-	defer db.Close()
-	storage.SeedCourses(db)
+	if err := store.Courses.SeedCourses(ctx); err != nil {
+		log.Printf("Ошибка при заполнении курсов: %v", err)
+	}
+	if err := seedAdmins(ctx, store, cfg.Admins); err != nil {
+		log.Fatalf("ADMINS: %v", err)
+	}
 
-	token := os.Getenv("TGBOT_API")
-	if token == "" {
-		log.Fatal("Токен не задан в переменной окружения TGBOT_API")
+	banks, err := quiz.Load(cfg.QuestionBanksDir)
+	if err != nil {
+		log.Fatalf("Question banks: %v", err)
 	}
 
-	bot, err := tgbotapi.NewBotAPI(token)
+	catalogs, err := i18n.Load()
+	if err != nil {
+		log.Fatalf("Locales: %v", err)
+	}
+	if err := catalogs.Check(); err != nil {
+		log.Fatalf("Locales are inconsistent:\n%v", err)
+	}
+
+	bot, err := tgbotapi.NewBotAPI(cfg.Telegram.Token)
 	if err != nil {
 		log.Fatal(err)
 	}
 
+	opts := tgbot.Options{
+		PaymentToken:  cfg.Payments.ProviderToken,
+		FakePayments:  cfg.Payments.Fake,
+		SupportChatID: cfg.Support.ChatID,
+		Settings:      cfg.Settings(),
+	}
+	if cfg.Telegram.Mode == "webhook" {
+		opts.Webhook = &tgbot.WebhookOptions{
+			Listen: cfg.Telegram.Webhook.Listen,
+			Secret: cfg.Telegram.Webhook.Secret,
+			URL:    cfg.Telegram.Webhook.URL,
+		}
+	}
+
 	fmt.Println("Bot started...")
 
-	if err := tgbot.Run(bot, db); err != nil {
-		log.Fatal(err)
+	runErr := tgbot.Run(ctx, bot, store, banks, catalogs, opts)
+	// Run возвращается, когда обработчики закончили писать в базу
+	if err := store.Close(); err != nil {
+		log.Printf("Ошибка при закрытии базы: %v", err)
+	}
+	if runErr != nil {
+		log.Fatal(runErr)
+	}
+	fmt.Println("Bot stopped")
+}
+
+// seedAdmins записывает сотрудников из настройки admins ("123:owner,456:manager").
+// Настройка — полный список: роли существующих сотрудников обновляются, а
+// тех, кого из неё убрали, бот при запуске лишает доступа.
+func seedAdmins(ctx context.Context, store *storage.Store, spec string) error {
+	admins, err := tgbot.ParseAdmins(spec)
+	if err != nil {
+		return err
 	}
+	return store.Admins.ReplaceAdmins(ctx, admins)
 }
 
-// func parseCourseSelection(text string) (int, error) {
-// 	var courseNumber int
-// 	_, err := fmt.Sscanf(text, "%d", &courseNumber)
-// 	return courseNumber, err
-// }
+// runMigrate выполняет подкоманду migrate: up, down [N] или status.
+func runMigrate(ctx context.Context, dsn string, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: migrate up | down [N] | status")
+	}
+
+	store, err := storage.Open(dsn)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	switch args[0] {
+	case "up":
+		applied, err := store.MigrateUp(ctx)
+		for _, m := range applied {
+			fmt.Printf("applied %d_%s\n", m.Version, m.Name)
+		}
+		if err == nil && len(applied) == 0 {
+			fmt.Println("schema is up to date")
+		}
+		return err
+
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			if steps, err = strconv.Atoi(args[1]); err != nil || steps < 1 {
+				return fmt.Errorf("invalid number of steps %q", args[1])
+			}
+		}
+		reverted, err := store.MigrateDown(ctx, steps)
+		for _, m := range reverted {
+			fmt.Printf("reverted %d_%s\n", m.Version, m.Name)
+		}
+		return err
+
+	case "status":
+		statuses, err := store.MigrationStatus(ctx)
+		if err != nil {
+			return err
+		}
+		for _, s := range statuses {
+			applied := "pending"
+			if s.AppliedAt != nil {
+				applied = "applied " + s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%3d  %-40s %s\n", s.Version, s.Name, applied)
+		}
+		return nil
+	}
+
+	return fmt.Errorf("unknown migrate command %q", args[0])
+}
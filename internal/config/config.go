@@ -0,0 +1,316 @@
+// Package config собирает настройки бота из значений по умолчанию,
+// необязательного YAML-файла, необязательного .env и переменных окружения.
+// Каждый следующий источник перекрывает предыдущий.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"tgbot/internal/storage"
+	"tgbot/internal/tgbot"
+
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
+)
+
+// Файл с переменными окружения. Если его нет, настройки берутся из окружения.
+const EnvFile = ".env"
+
+// Чем заменяются секреты в Redacted.
+const redacted = "***"
+
+type Config struct {
+	// Environment — production или development; тестовые платежи разрешены
+	// только в development
+	Environment      string   `yaml:"environment"`
+	Telegram         Telegram `yaml:"telegram"`
+	Database         Database `yaml:"database"`
+	Payments         Payments `yaml:"payments"`
+	Support          Support  `yaml:"support"`
+	Admins           string   `yaml:"admins"`             // "123:owner,456:manager", полный список сотрудников
+	QuestionBanksDir string   `yaml:"question_banks_dir"` // пусто — встроенные банки
+	Bot              Bot      `yaml:"bot"`
+}
+
+type Telegram struct {
+	Token       string        `yaml:"token"`
+	Mode        string        `yaml:"mode"` // polling или webhook
+	PollTimeout time.Duration `yaml:"poll_timeout"`
+	Webhook     Webhook       `yaml:"webhook"`
+}
+
+type Webhook struct {
+	Listen string `yaml:"listen"`
+	Secret string `yaml:"secret"`
+	URL    string `yaml:"url"`
+}
+
+type Database struct {
+	// URL — postgres://... для PostgreSQL или путь к файлу SQLite
+	URL string `yaml:"url"`
+}
+
+type Payments struct {
+	// ProviderToken — токен платёжного провайдера из BotFather
+	ProviderToken string `yaml:"provider_token"`
+	// Fake включает тестовые счета, которые оплачиваются кнопкой без
+	// списания денег. Нужен явно: без токена бот иначе не запустится
+	Fake bool `yaml:"fake"`
+}
+
+type Support struct {
+	// ChatID — группа сотрудников для /support; 0 — чат выключен
+	ChatID int64 `yaml:"chat_id"`
+}
+
+type Bot struct {
+	PaymentReminderDelay time.Duration `yaml:"payment_reminder_delay"`
+	SeatOfferTTL         time.Duration `yaml:"seat_offer_ttl"`
+	MessageChunkSize     int           `yaml:"message_chunk_size"`
+	LevelBeginnerMax     float64       `yaml:"level_beginner_max"`
+	LevelIntermediateMax float64       `yaml:"level_intermediate_max"`
+	ShutdownTimeout      time.Duration `yaml:"shutdown_timeout"`
+}
+
+// Default возвращает настройки по умолчанию.
+func Default() Config {
+	s := tgbot.DefaultSettings()
+	return Config{
+		Environment: "production",
+		Telegram: Telegram{
+			Mode:        "polling",
+			PollTimeout: s.PollTimeout,
+			Webhook:     Webhook{Listen: ":8080"},
+		},
+		Database: Database{URL: storage.DefaultDSN},
+		Bot: Bot{
+			PaymentReminderDelay: s.PaymentReminderDelay,
+			SeatOfferTTL:         s.SeatOfferTTL,
+			MessageChunkSize:     s.MessageChunkSize,
+			LevelBeginnerMax:     s.Levels.Beginner,
+			LevelIntermediateMax: s.Levels.Intermediate,
+			ShutdownTimeout:      s.ShutdownTimeout,
+		},
+	}
+}
+
+// Load читает настройки. path — YAML-файл; если пуст, используется
+// CONFIG_FILE, а без него файл не читается. Отсутствие .env не ошибка.
+// Load не проверяет значения: для этого есть Validate.
+func Load(path string) (Config, error) {
+	cfg := Default()
+
+	// .env не перекрывает переменные, уже заданные в окружении
+	if err := godotenv.Load(EnvFile); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return cfg, fmt.Errorf("failed to load %s: %w", EnvFile, err)
+	}
+
+	if path == "" {
+		path = os.Getenv("CONFIG_FILE")
+	}
+	if path != "" {
+		if err := cfg.loadFile(path); err != nil {
+			return cfg, err
+		}
+	}
+
+	if err := cfg.loadEnv(); err != nil {
+		return cfg, err
+	}
+	return cfg, nil
+}
+
+func (c *Config) loadFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open config: %w", err)
+	}
+	defer f.Close()
+
+	dec := yaml.NewDecoder(f)
+	// Опечатка в имени поля иначе молча оставила бы значение по умолчанию
+	dec.KnownFields(true)
+	// Пустой файл или файл из одних комментариев — это настройки по умолчанию
+	if err := dec.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("failed to parse config %s: %w", path, err)
+	}
+	return nil
+}
+
+// envVar связывает переменную окружения с полем Config.
+type envVar struct {
+	name string
+	set  func(string) error
+}
+
+func (c *Config) envVars() []envVar {
+	return []envVar{
+		{"APP_ENV", setString(&c.Environment)},
+		{"TGBOT_API", setString(&c.Telegram.Token)},
+		{"BOT_MODE", setString(&c.Telegram.Mode)},
+		{"POLL_TIMEOUT", setDuration(&c.Telegram.PollTimeout)},
+		{"WEBHOOK_LISTEN", setString(&c.Telegram.Webhook.Listen)},
+		{"WEBHOOK_SECRET", setString(&c.Telegram.Webhook.Secret)},
+		{"WEBHOOK_URL", setString(&c.Telegram.Webhook.URL)},
+		{"DATABASE_URL", setString(&c.Database.URL)},
+		{"PAYMENT_PROVIDER_TOKEN", setString(&c.Payments.ProviderToken)},
+		{"PAYMENTS_FAKE", setBool(&c.Payments.Fake)},
+		{"SUPPORT_CHAT_ID", setInt64(&c.Support.ChatID)},
+		{"ADMINS", setString(&c.Admins)},
+		{"QUESTION_BANKS_DIR", setString(&c.QuestionBanksDir)},
+		{"PAYMENT_REMINDER_DELAY", setDuration(&c.Bot.PaymentReminderDelay)},
+		{"SEAT_OFFER_TTL", setDuration(&c.Bot.SeatOfferTTL)},
+		{"MESSAGE_CHUNK_SIZE", setInt(&c.Bot.MessageChunkSize)},
+		{"LEVEL_BEGINNER_MAX", setFloat(&c.Bot.LevelBeginnerMax)},
+		{"LEVEL_INTERMEDIATE_MAX", setFloat(&c.Bot.LevelIntermediateMax)},
+		{"SHUTDOWN_TIMEOUT", setDuration(&c.Bot.ShutdownTimeout)},
+	}
+}
+
+// loadEnv применяет непустые переменные окружения.
+func (c *Config) loadEnv() error {
+	for _, v := range c.envVars() {
+		raw, ok := os.LookupEnv(v.name)
+		if !ok || raw == "" {
+			continue
+		}
+		if err := v.set(strings.TrimSpace(raw)); err != nil {
+			return fmt.Errorf("%s: %w", v.name, err)
+		}
+	}
+	return nil
+}
+
+func setString(p *string) func(string) error {
+	return func(s string) error {
+		*p = s
+		return nil
+	}
+}
+
+func setInt(p *int) func(string) error {
+	return func(s string) (err error) {
+		*p, err = strconv.Atoi(s)
+		return err
+	}
+}
+
+func setInt64(p *int64) func(string) error {
+	return func(s string) (err error) {
+		*p, err = strconv.ParseInt(s, 10, 64)
+		return err
+	}
+}
+
+func setFloat(p *float64) func(string) error {
+	return func(s string) (err error) {
+		*p, err = strconv.ParseFloat(s, 64)
+		return err
+	}
+}
+
+func setBool(p *bool) func(string) error {
+	return func(s string) (err error) {
+		*p, err = strconv.ParseBool(s)
+		return err
+	}
+}
+
+func setDuration(p *time.Duration) func(string) error {
+	return func(s string) (err error) {
+		*p, err = time.ParseDuration(s)
+		return err
+	}
+}
+
+// Validate проверяет настройки, нужные для запуска бота, и возвращает все
+// найденные ошибки сразу.
+func (c Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(c.Telegram.Token != "", "telegram.token (TGBOT_API) is required")
+	switch c.Telegram.Mode {
+	case "polling":
+	case "webhook":
+		check(c.Telegram.Webhook.Secret != "", "telegram.webhook.secret (WEBHOOK_SECRET) is required in webhook mode")
+		check(c.Telegram.Webhook.Listen != "", "telegram.webhook.listen (WEBHOOK_LISTEN) is required in webhook mode")
+		if c.Telegram.Webhook.URL != "" {
+			u, err := url.Parse(c.Telegram.Webhook.URL)
+			check(err == nil && u.Scheme == "https", "telegram.webhook.url (WEBHOOK_URL) must be an https URL")
+		}
+	default:
+		errs = append(errs, fmt.Errorf("unknown telegram.mode (BOT_MODE) %q, expected polling or webhook", c.Telegram.Mode))
+	}
+	check(c.Telegram.PollTimeout >= time.Second, "telegram.poll_timeout (POLL_TIMEOUT) must be at least 1s")
+	check(c.Database.URL != "", "database.url (DATABASE_URL) is required")
+
+	check(c.Environment == "production" || c.Environment == "development",
+		"unknown environment (APP_ENV) %q, expected production or development", c.Environment)
+	switch {
+	case c.Payments.Fake:
+		check(c.Environment == "development", "payments.fake (PAYMENTS_FAKE) is allowed only in development")
+		check(c.Payments.ProviderToken == "", "payments.fake (PAYMENTS_FAKE) cannot be combined with payments.provider_token (PAYMENT_PROVIDER_TOKEN)")
+	default:
+		check(c.Payments.ProviderToken != "", "payments.provider_token (PAYMENT_PROVIDER_TOKEN) is required; for local runs set payments.fake (PAYMENTS_FAKE) in development")
+	}
+
+	check(c.Bot.PaymentReminderDelay > 0, "bot.payment_reminder_delay (PAYMENT_REMINDER_DELAY) must be positive")
+	check(c.Bot.SeatOfferTTL > 0, "bot.seat_offer_ttl (SEAT_OFFER_TTL) must be positive")
+	check(c.Bot.ShutdownTimeout > 0, "bot.shutdown_timeout (SHUTDOWN_TIMEOUT) must be positive")
+	check(c.Bot.MessageChunkSize > 0 && c.Bot.MessageChunkSize <= 4096,
+		"bot.message_chunk_size (MESSAGE_CHUNK_SIZE) must be between 1 and 4096")
+	check(0 < c.Bot.LevelBeginnerMax && c.Bot.LevelBeginnerMax < c.Bot.LevelIntermediateMax && c.Bot.LevelIntermediateMax < 1,
+		"level thresholds must satisfy 0 < bot.level_beginner_max < bot.level_intermediate_max < 1")
+
+	return errors.Join(errs...)
+}
+
+// Redacted возвращает копию настроек со скрытыми токенами, секретом
+// webhook и паролем в адресе базы — для вывода в лог или консоль.
+func (c Config) Redacted() Config {
+	hide := func(s string) string {
+		if s == "" {
+			return ""
+		}
+		return redacted
+	}
+	c.Telegram.Token = hide(c.Telegram.Token)
+	c.Telegram.Webhook.Secret = hide(c.Telegram.Webhook.Secret)
+	c.Payments.ProviderToken = hide(c.Payments.ProviderToken)
+	if u, err := url.Parse(c.Database.URL); err == nil {
+		c.Database.URL = u.Redacted()
+	}
+	return c
+}
+
+// YAML возвращает настройки в формате конфигурационного файла.
+func (c Config) YAML() ([]byte, error) {
+	return yaml.Marshal(c)
+}
+
+// Settings переводит настройки в параметры поведения бота.
+func (c Config) Settings() tgbot.Settings {
+	return tgbot.Settings{
+		PollTimeout:          c.Telegram.PollTimeout,
+		MessageChunkSize:     c.Bot.MessageChunkSize,
+		PaymentReminderDelay: c.Bot.PaymentReminderDelay,
+		SeatOfferTTL:         c.Bot.SeatOfferTTL,
+		Levels: tgbot.LevelThresholds{
+			Beginner:     c.Bot.LevelBeginnerMax,
+			Intermediate: c.Bot.LevelIntermediateMax,
+		},
+		ShutdownTimeout: c.Bot.ShutdownTimeout,
+	}
+}
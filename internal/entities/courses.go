@@ -1,22 +1,118 @@
 package entities
 
+import "time"
+
 type Course struct {
+	ID          int64
 	Name        string
+	Track       string // направление: go, python, cpp
 	Level       string
+	Topic       string // тема теста направления, пусто — подбирается по общему уровню
 	Price       float64
 	Teacher     string
 	Schedule    string
 	Description string
+	Capacity    int // мест в группе, 0 — без ограничений
+	Archived    bool
+	// Translations — название и описание на других языках, ключ — код языка
+	Translations map[string]CourseTranslation
+}
+
+type CourseTranslation struct {
+	Name        string
+	Description string
+}
+
+// Localized возвращает курс с названием и описанием на языке lang.
+// Непереведённые поля остаются на основном языке.
+func (c Course) Localized(lang string) Course {
+	t, ok := c.Translations[lang]
+	if !ok {
+		return c
+	}
+	if t.Name != "" {
+		c.Name = t.Name
+	}
+	if t.Description != "" {
+		c.Description = t.Description
+	}
+	return c
 }
 
 type UserState struct {
-	Step         string
-	Name         string
-	PhoneNumber  string // Added PhoneNumber
-	Selected     *Course
-	TestIndex    int
-	TestScore    int
-	IsTakingTest bool
+	Step          string
+	Name          string
+	PhoneNumber   string // Added PhoneNumber
+	Selected      *Course
+	Track         string // направление, по которому проходится тест
+	TestIndex     int
+	TestScore     int
+	IsTakingTest  bool
+	TestSeed      int64        // seed адаптивного теста
+	TestAnswers   []TestAnswer // ответы текущего теста по порядку
+	TestAttemptID int64        // попытка теста в test_attempts, 0 — не записывается
+	CourseDraft   *CourseDraft // курс, который сотрудник создаёт или редактирует
+	Language      string       // код языка интерфейса, пусто — ещё не выбран
+}
+
+// TestAnswer — ответ на вопрос вступительного теста.
+type TestAnswer struct {
+	Question int  `json:"question"` // индекс вопроса в банке
+	Correct  bool `json:"correct"`
+}
+
+// TestAttempt — попытка вступительного теста. Попытка остаётся
+// незавершённой, если пользователь бросил тест.
+type TestAttempt struct {
+	ID          int64
+	UserID      int64
+	Name        string // из профиля пользователя
+	PhoneNumber string
+	Track       string
+	Score       int
+	Total       int
+	Level       string            // общий уровень, пусто — тест не завершён
+	TopicLevels map[string]string // уровень по темам, ключ — ID темы
+	StartedAt   time.Time
+	FinishedAt  time.Time // нулевое — тест не завершён
+	Enrolled    bool      // пользователь записывался на курс
+	Answers     []TestAttemptAnswer
+}
+
+func (a TestAttempt) Finished() bool {
+	return !a.FinishedAt.IsZero()
+}
+
+// TestAttemptAnswer — вопрос, показанный в попытке, и ответ на него.
+type TestAttemptAnswer struct {
+	Position   int // номер вопроса в попытке, с единицы
+	Question   int // индекс вопроса в банке
+	Text       string
+	Topic      string
+	Level      string
+	Answer     int // выбранный вариант с нуля, -1 — ответа нет
+	AnswerText string
+	Correct    bool
+	ShownAt    time.Time
+	AnsweredAt time.Time // нулевое — вопрос остался без ответа
+}
+
+func (a TestAttemptAnswer) Answered() bool {
+	return !a.AnsweredAt.IsZero()
+}
+
+// Действия сотрудника над курсом.
+const (
+	CourseAdd     = "add"
+	CourseEdit    = "edit"
+	CourseArchive = "archive"
+)
+
+// CourseDraft — незавершённое изменение курса в диалоге сотрудника.
+type CourseDraft struct {
+	Action string
+	Course Course
+	Field  int // номер поля, которое вводится сейчас
 }
 
 type Message struct {
@@ -26,21 +122,51 @@ type Message struct {
 }
 
 type Enrollment struct {
+	ID          int64
 	UserID      int64 // Added UserID
 	Name        string
 	PhoneNumber string
+	CourseID    int64
 	CourseName  string
 	IsPaid      bool
 	TestScore   int
 	Timestamp   string
+	Canceled    bool // запись отменена, например после возврата оплаты
+
+	// Заполняются после подтверждённой оплаты через Telegram Payments
+	TelegramChargeID string
+	ProviderChargeID string
+	PaidAt           string
+}
+
+// Статусы вопроса пользователя
+const (
+	QuestionOpen     = "open"
+	QuestionAnswered = "answered"
+	QuestionClosed   = "closed"
+)
+
+// User — профиль пользователя бота. Заполняется при знакомстве и меняется
+// командой /profile; записи на курсы ссылаются на него по TelegramID.
+type User struct {
+	TelegramID  int64
+	Name        string
+	PhoneNumber string
+	Language    string
+	CreatedAt   time.Time
+	LastSeenAt  time.Time
 }
 
 type UserQuestion struct {
+	ID           int64
 	UserID       int64
 	Name         string // Added Name
 	PhoneNumber  string // Added PhoneNumber
 	QuestionText string
 	Timestamp    string
+	Status       string
+	Answer       string // последний ответ сотрудника
+	AnsweredAt   string
 }
 
 type UserQuestionDetail struct {
@@ -49,3 +175,52 @@ type UserQuestionDetail struct {
 	QuestionText string
 	Timestamp    string
 }
+
+// Role — роль сотрудника школы в боте.
+type Role string
+
+const (
+	RoleOwner   Role = "owner"
+	RoleManager Role = "manager"
+	RoleTeacher Role = "teacher"
+)
+
+// Статусы отложенных задач.
+const (
+	JobPending  = "pending"
+	JobRunning  = "running" // задачу выполняет один из экземпляров бота
+	JobDone     = "done"
+	JobFailed   = "failed"
+	JobCanceled = "canceled"
+)
+
+// ScheduledJob — отложенная задача, например напоминание об оплате.
+// Kind определяет обработчик, Payload — его данные.
+type ScheduledJob struct {
+	ID       int64
+	Kind     string
+	ChatID   int64
+	Payload  string
+	RunAt    time.Time
+	Status   string
+	Attempts int
+}
+
+// Статусы записи в листе ожидания.
+const (
+	WaitlistWaiting  = "waiting"
+	WaitlistOffered  = "offered"  // пользователю предложено освободившееся место
+	WaitlistEnrolled = "enrolled" // место оплачено
+	WaitlistExpired  = "expired"  // предложение истекло
+)
+
+// WaitlistEntry — пользователь в листе ожидания курса.
+type WaitlistEntry struct {
+	ID             int64
+	UserID         int64
+	CourseID       int64
+	CourseName     string
+	Status         string
+	Position       int // место в очереди среди ожидающих, 0 — если не ждёт
+	OfferExpiresAt time.Time
+}
@@ -0,0 +1,292 @@
+// Package i18n хранит переводы сообщений бота. Каталоги лежат в YAML-файлах
+// по одному на язык; сообщение — строка fmt или набор форм множественного числа.
+package i18n
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+//go:embed locales/*.yaml
+var embedded embed.FS
+
+// DefaultLanguage — язык, на котором написан эталонный каталог. Он же
+// используется, если язык пользователя не поддерживается.
+const DefaultLanguage = "ru"
+
+// Message — текст сообщения. Для сообщений с числом вместо Text заполнен
+// Forms: форма множественного числа (one, few, many, other) → текст.
+type Message struct {
+	Text  string
+	Forms map[string]string
+}
+
+func (m *Message) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		return node.Decode(&m.Text)
+	}
+	return node.Decode(&m.Forms)
+}
+
+// Catalog — сообщения одного языка.
+type Catalog struct {
+	Language string             `yaml:"language"`
+	Name     string             `yaml:"name"` // самоназвание языка, например «Қазақша»
+	Messages map[string]Message `yaml:"messages"`
+}
+
+// Bundle — набор каталогов. Первым идёт каталог DefaultLanguage.
+type Bundle struct {
+	catalogs map[string]*Catalog
+	order    []string
+}
+
+// Load читает встроенные каталоги.
+func Load() (*Bundle, error) {
+	sub, err := fs.Sub(embedded, "locales")
+	if err != nil {
+		return nil, err
+	}
+	return LoadFS(sub)
+}
+
+// LoadFS читает все каталоги *.yaml из корня fsys.
+func LoadFS(fsys fs.FS) (*Bundle, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	b := &Bundle{catalogs: make(map[string]*Catalog)}
+	for _, e := range entries {
+		if e.IsDir() || path.Ext(e.Name()) != ".yaml" {
+			continue
+		}
+		data, err := fs.ReadFile(fsys, e.Name())
+		if err != nil {
+			return nil, err
+		}
+		var c Catalog
+		if err := yaml.Unmarshal(data, &c); err != nil {
+			return nil, fmt.Errorf("%s: %w", e.Name(), err)
+		}
+		if c.Language == "" {
+			return nil, fmt.Errorf("%s: language is not set", e.Name())
+		}
+		if _, ok := pluralRules[c.Language]; !ok {
+			return nil, fmt.Errorf("%s: no plural rule for language %q", e.Name(), c.Language)
+		}
+		if _, dup := b.catalogs[c.Language]; dup {
+			return nil, fmt.Errorf("%s: duplicate catalog for language %q", e.Name(), c.Language)
+		}
+		b.catalogs[c.Language] = &c
+		b.order = append(b.order, c.Language)
+	}
+
+	if _, ok := b.catalogs[DefaultLanguage]; !ok {
+		return nil, fmt.Errorf("no catalog for default language %q", DefaultLanguage)
+	}
+	sort.Slice(b.order, func(i, j int) bool {
+		if b.order[i] == DefaultLanguage || b.order[j] == DefaultLanguage {
+			return b.order[i] == DefaultLanguage
+		}
+		return b.order[i] < b.order[j]
+	})
+	return b, nil
+}
+
+// Check сверяет каталоги с каталогом DefaultLanguage: в каждом должны быть
+// все его сообщения, все формы множественного числа своего языка и те же
+// подстановки fmt. Возвращает все найденные расхождения.
+func (b *Bundle) Check() error {
+	base := b.catalogs[DefaultLanguage]
+	var errs []error
+	for _, lang := range b.order {
+		c := b.catalogs[lang]
+		forms := pluralRules[lang].forms
+		for _, key := range sortedKeys(base.Messages) {
+			want := base.Messages[key]
+			got, ok := c.Messages[key]
+			if !ok {
+				errs = append(errs, fmt.Errorf("%s: missing message %q", lang, key))
+				continue
+			}
+			if (want.Forms == nil) != (got.Forms == nil) {
+				errs = append(errs, fmt.Errorf("%s: message %q must be %s", lang, key, kindOf(want)))
+				continue
+			}
+			wantVerbs := verbs(want.reference())
+			for _, text := range got.texts(forms) {
+				if text == nil {
+					errs = append(errs, fmt.Errorf("%s: message %q lacks plural forms %s", lang, key, strings.Join(forms, ", ")))
+					break
+				}
+				if v := verbs(*text); v != wantVerbs {
+					errs = append(errs, fmt.Errorf("%s: message %q has placeholders %q, want %q", lang, key, v, wantVerbs))
+					break
+				}
+			}
+		}
+		for _, key := range sortedKeys(c.Messages) {
+			if _, ok := base.Messages[key]; !ok {
+				errs = append(errs, fmt.Errorf("%s: unknown message %q", lang, key))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func kindOf(m Message) string {
+	if m.Forms != nil {
+		return "a set of plural forms"
+	}
+	return "a plain string"
+}
+
+// reference — текст, с подстановками которого сверяются переводы.
+func (m Message) reference() string {
+	if m.Forms == nil {
+		return m.Text
+	}
+	for _, form := range []string{"other", "many", "few", "one"} {
+		if text, ok := m.Forms[form]; ok {
+			return text
+		}
+	}
+	return ""
+}
+
+// texts возвращает текст сообщения или его формы; nil — форма отсутствует.
+func (m Message) texts(forms []string) []*string {
+	if m.Forms == nil {
+		return []*string{&m.Text}
+	}
+	texts := make([]*string, 0, len(forms))
+	for _, form := range forms {
+		if text, ok := m.Forms[form]; ok {
+			texts = append(texts, &text)
+		} else {
+			texts = append(texts, nil)
+		}
+	}
+	return texts
+}
+
+var verbRe = regexp.MustCompile(`%(?:\[\d+\])?[-+# 0]*\d*(?:\.\d+)?[a-zA-Z%]`)
+
+// verbs возвращает подстановки fmt без номеров аргументов в порядке
+// сортировки: перевод может переставлять аргументы через %[2]s.
+func verbs(text string) string {
+	found := verbRe.FindAllString(text, -1)
+	for i, v := range found {
+		if j := strings.Index(v, "]"); j >= 0 {
+			found[i] = "%" + v[j+1:]
+		}
+	}
+	sort.Strings(found)
+	return strings.Join(found, " ")
+}
+
+func sortedKeys(m map[string]Message) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Languages возвращает поддерживаемые языки, первым — DefaultLanguage.
+func (b *Bundle) Languages() []string {
+	return b.order
+}
+
+// Name возвращает самоназвание языка.
+func (b *Bundle) Name(lang string) string {
+	if c, ok := b.catalogs[lang]; ok && c.Name != "" {
+		return c.Name
+	}
+	return lang
+}
+
+// Match подбирает поддерживаемый язык по коду IETF из Telegram, например
+// "en-US" → "en". Пустая строка — язык не поддерживается.
+func (b *Bundle) Match(code string) string {
+	code = strings.ToLower(code)
+	if _, ok := b.catalogs[code]; ok {
+		return code
+	}
+	base, _, _ := strings.Cut(code, "-")
+	if _, ok := b.catalogs[base]; ok {
+		return base
+	}
+	return ""
+}
+
+// Localizer возвращает переводчик на язык lang. Неизвестный язык
+// заменяется DefaultLanguage.
+func (b *Bundle) Localizer(lang string) *Localizer {
+	c, ok := b.catalogs[lang]
+	if !ok {
+		c = b.catalogs[DefaultLanguage]
+	}
+	return &Localizer{catalog: c, fallback: b.catalogs[DefaultLanguage]}
+}
+
+// Localizer переводит сообщения на один язык.
+type Localizer struct {
+	catalog  *Catalog
+	fallback *Catalog
+}
+
+func (l *Localizer) Language() string {
+	return l.catalog.Language
+}
+
+func (l *Localizer) message(key string) Message {
+	if m, ok := l.catalog.Messages[key]; ok {
+		return m
+	}
+	if m, ok := l.fallback.Messages[key]; ok {
+		log.Printf("Нет перевода сообщения %q на язык %s", key, l.catalog.Language)
+		return m
+	}
+	log.Printf("Неизвестное сообщение %q", key)
+	return Message{Text: key}
+}
+
+// T возвращает сообщение key, подставив args как в fmt.Sprintf.
+func (l *Localizer) T(key string, args ...any) string {
+	m := l.message(key)
+	text := m.Text
+	if m.Forms != nil {
+		text = m.reference()
+	}
+	if len(args) == 0 {
+		return text
+	}
+	return fmt.Sprintf(text, args...)
+}
+
+// N выбирает форму сообщения key по числу n. n в текст не подставляется
+// сам: его нужно передать среди args.
+func (l *Localizer) N(key string, n int, args ...any) string {
+	m := l.message(key)
+	if m.Forms == nil {
+		return fmt.Sprintf(m.Text, args...)
+	}
+	text, ok := m.Forms[pluralRules[l.catalog.Language].form(n)]
+	if !ok {
+		text = m.reference()
+	}
+	return fmt.Sprintf(text, args...)
+}
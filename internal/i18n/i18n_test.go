@@ -0,0 +1,230 @@
+package i18n
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func loadCatalogs(t *testing.T, files map[string]string) *Bundle {
+	t.Helper()
+	fsys := fstest.MapFS{}
+	for name, data := range files {
+		fsys[name] = &fstest.MapFile{Data: []byte(data)}
+	}
+	b, err := LoadFS(fsys)
+	if err != nil {
+		t.Fatalf("LoadFS: %v", err)
+	}
+	return b
+}
+
+const ruCatalog = `
+language: ru
+name: Русский
+messages:
+  greeting: "Привет, %s!"
+  score: "%s набрал %d баллов"
+  courses:
+    one: "%d курс"
+    few: "%d курса"
+    many: "%d курсов"
+`
+
+func TestEmbeddedCatalogsConsistent(t *testing.T) {
+	b, err := Load()
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if err := b.Check(); err != nil {
+		t.Fatalf("каталоги расходятся:\n%v", err)
+	}
+	if langs := b.Languages(); len(langs) == 0 || langs[0] != DefaultLanguage {
+		t.Fatalf("языки: %v", langs)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name string
+		en   string
+		want []string // пусто — каталоги согласованы
+	}{
+		{"согласованный каталог", `
+language: en
+messages:
+  greeting: "Hello, %s!"
+  score: "%s scored %d points"
+  courses: {one: "%d course", other: "%d courses"}
+`, nil},
+		{"аргументы переставлены через %[n]", `
+language: en
+messages:
+  greeting: "Hello, %s!"
+  score: "%[2]d points for %[1]s"
+  courses: {one: "%d course", other: "%d courses"}
+`, nil},
+		{"нет сообщения и лишнее сообщение", `
+language: en
+messages:
+  greeting: "Hello, %s!"
+  courses: {one: "%d course", other: "%d courses"}
+  farewell: "Bye"
+`, []string{`missing message "score"`, `unknown message "farewell"`}},
+		{"другие подстановки", `
+language: en
+messages:
+  greeting: "Hello, %d!"
+  score: "%s scored points"
+  courses: {one: "%d course", other: "%s courses"}
+`, []string{`"greeting" has placeholders`, `"score" has placeholders`, `"courses" has placeholders`}},
+		{"не хватает формы множественного числа", `
+language: en
+messages:
+  greeting: "Hello, %s!"
+  score: "%s scored %d points"
+  courses: {one: "%d course"}
+`, []string{`"courses" lacks plural forms one, other`}},
+		{"строка вместо форм", `
+language: en
+messages:
+  greeting: {one: "Hello, %s!", other: "Hello, %s!"}
+  score: "%s scored %d points"
+  courses: "%d courses"
+`, []string{`"greeting" must be a plain string`, `"courses" must be a set of plural forms`}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := loadCatalogs(t, map[string]string{"ru.yaml": ruCatalog, "en.yaml": tt.en})
+			err := b.Check()
+			if len(tt.want) == 0 {
+				if err != nil {
+					t.Fatalf("неожиданные расхождения: %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("расхождения не найдены")
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("нет ошибки %q в:\n%v", want, err)
+				}
+			}
+		})
+	}
+}
+
+func TestCheckRussianForms(t *testing.T) {
+	// В эталонном каталоге тоже проверяются все формы своего языка
+	b := loadCatalogs(t, map[string]string{"ru.yaml": `
+language: ru
+messages:
+  courses: {one: "%d курс", other: "%d курсов"}
+`})
+	if err := b.Check(); err == nil || !strings.Contains(err.Error(), "lacks plural forms one, few, many") {
+		t.Fatalf("Check: %v", err)
+	}
+}
+
+func TestVerbs(t *testing.T) {
+	tests := []struct{ text, want string }{
+		{"без подстановок", ""},
+		{"%s и %d", "%d %s"},
+		{"%[2]d и %[1]s", "%d %s"},
+		{"%.2f₽, 100%%", "%% %.2f"},
+		{"%-10s|%05d", "%-10s %05d"},
+	}
+	for _, tt := range tests {
+		if got := verbs(tt.text); got != tt.want {
+			t.Errorf("verbs(%q) = %q, ожидалось %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestRussianPlural(t *testing.T) {
+	b := loadCatalogs(t, map[string]string{"ru.yaml": ruCatalog})
+	l := b.Localizer("ru")
+	tests := []struct {
+		n    int
+		want string
+	}{
+		{0, "0 курсов"},
+		{1, "1 курс"},
+		{2, "2 курса"},
+		{4, "4 курса"},
+		{5, "5 курсов"},
+		{11, "11 курсов"},
+		{12, "12 курсов"},
+		{14, "14 курсов"},
+		{21, "21 курс"},
+		{22, "22 курса"},
+		{25, "25 курсов"},
+		{101, "101 курс"},
+		{111, "111 курсов"},
+		{-1, "-1 курс"},
+	}
+	for _, tt := range tests {
+		if got := l.N("courses", tt.n, tt.n); got != tt.want {
+			t.Errorf("N(courses, %d) = %q, ожидалось %q", tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestOneOtherPlural(t *testing.T) {
+	for n, want := range map[int]string{0: "other", 1: "one", 2: "other", 21: "other", -1: "one"} {
+		if got := pluralRules["en"].form(n); got != want {
+			t.Errorf("en form(%d) = %q, ожидалось %q", n, got, want)
+		}
+	}
+}
+
+func TestLocalizerFallback(t *testing.T) {
+	b := loadCatalogs(t, map[string]string{
+		"ru.yaml": ruCatalog,
+		"en.yaml": "language: en\nname: English\nmessages:\n  greeting: \"Hello, %s!\"\n",
+	})
+	if got := b.Localizer("en").T("greeting", "Ann"); got != "Hello, Ann!" {
+		t.Errorf("перевод: %q", got)
+	}
+	// Нет перевода — сообщение на языке по умолчанию
+	if got := b.Localizer("en").T("score", "Ann", 5); got != "Ann набрал 5 баллов" {
+		t.Errorf("без перевода: %q", got)
+	}
+	// Неизвестный язык заменяется языком по умолчанию
+	if got := b.Localizer("de").T("greeting", "Ann"); got != "Привет, Ann!" {
+		t.Errorf("неизвестный язык: %q", got)
+	}
+	if got := b.Localizer("ru").T("missing.key"); got != "missing.key" {
+		t.Errorf("неизвестное сообщение: %q", got)
+	}
+	for code, want := range map[string]string{"en-US": "en", "RU": "ru", "de": "", "": ""} {
+		if got := b.Match(code); got != want {
+			t.Errorf("Match(%q) = %q, ожидалось %q", code, got, want)
+		}
+	}
+}
+
+func TestLoadFSErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		want  string
+	}{
+		{"нет языка", map[string]string{"ru.yaml": "messages: {}"}, "language is not set"},
+		{"нет правила множественного числа", map[string]string{"ru.yaml": ruCatalog, "de.yaml": "language: de"}, `no plural rule for language "de"`},
+		{"два каталога одного языка", map[string]string{"ru.yaml": ruCatalog, "ru2.yaml": ruCatalog}, "duplicate catalog"},
+		{"нет каталога по умолчанию", map[string]string{"en.yaml": "language: en"}, "no catalog for default language"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fsys := fstest.MapFS{}
+			for name, data := range tt.files {
+				fsys[name] = &fstest.MapFile{Data: []byte(data)}
+			}
+			if _, err := LoadFS(fsys); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("ошибка %v, ожидалась с %q", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,36 @@
+package i18n
+
+// pluralRule — правило выбора формы множественного числа по CLDR для целых n.
+type pluralRule struct {
+	forms []string // формы, которые должны быть в каталоге языка
+	form  func(n int) string
+}
+
+var pluralRules = map[string]pluralRule{
+	// 1 курс, 2 курса, 5 курсов, 21 курс, 11 курсов
+	"ru": {
+		forms: []string{"one", "few", "many"},
+		form: func(n int) string {
+			if n < 0 {
+				n = -n
+			}
+			switch {
+			case n%10 == 1 && n%100 != 11:
+				return "one"
+			case n%10 >= 2 && n%10 <= 4 && (n%100 < 12 || n%100 > 14):
+				return "few"
+			default:
+				return "many"
+			}
+		},
+	},
+	"kk": {forms: []string{"one", "other"}, form: oneOther},
+	"en": {forms: []string{"one", "other"}, form: oneOther},
+}
+
+func oneOther(n int) string {
+	if n == 1 || n == -1 {
+		return "one"
+	}
+	return "other"
+}
@@ -0,0 +1,227 @@
+package quiz
+
+import "math/rand"
+
+// Answer — ответ на вопрос адаптивного теста.
+type Answer struct {
+	Question int  `json:"question"` // индекс вопроса в банке
+	Correct  bool `json:"correct"`
+}
+
+// Session — адаптивный тест по одному банку.
+//
+// Для каждой темы хранится целевая сложность: после верного ответа она
+// становится на уровень выше сложности вопроса, после неверного — на
+// уровень ниже. Следующий вопрос берётся из темы, по которой задано меньше
+// всего вопросов, с ближайшей к целевой сложностью. Равные варианты
+// выбирает генератор с seed, поэтому сессия с тем же seed и теми же
+// ответами задаёт те же вопросы.
+type Session struct {
+	bank    *Bank
+	rng     *rand.Rand
+	answers []Answer
+	asked   map[int]bool
+	target  map[string]int // целевая сложность по теме
+	current int            // индекс текущего вопроса, -1 — тест окончен
+}
+
+// startDifficulty — с какой сложности начинается каждая тема.
+const startDifficulty = 1
+
+func NewSession(bank *Bank, seed int64) *Session {
+	s := &Session{
+		bank:   bank,
+		rng:    rand.New(rand.NewSource(seed)),
+		asked:  make(map[int]bool),
+		target: make(map[string]int),
+	}
+	s.current = s.pick()
+	return s
+}
+
+// Resume восстанавливает сессию по seed и уже данным ответам. Ответы на
+// вопросы, которых больше нет в банке, пропускаются.
+func Resume(bank *Bank, seed int64, answers []Answer) *Session {
+	s := NewSession(bank, seed)
+	for _, a := range answers {
+		if s.Done() {
+			break
+		}
+		if a.Question < 0 || a.Question >= len(bank.Questions) || s.asked[a.Question] {
+			continue
+		}
+		s.record(a)
+	}
+	return s
+}
+
+// Length возвращает, сколько вопросов будет задано всего.
+func (s *Session) Length() int {
+	return s.bank.TestLength()
+}
+
+func (s *Session) Done() bool {
+	return s.current < 0
+}
+
+// Current возвращает индекс и текущий вопрос. Для оконченного теста ok — false.
+func (s *Session) Current() (index int, q Question, ok bool) {
+	if s.Done() {
+		return -1, Question{}, false
+	}
+	return s.current, s.bank.Questions[s.current], true
+}
+
+// Answer принимает вариант option (с нуля) на текущий вопрос, выбирает
+// следующий и сообщает, верен ли ответ.
+func (s *Session) Answer(option int) bool {
+	if s.Done() {
+		return false
+	}
+	correct := option == s.bank.Questions[s.current].Answer
+	s.record(Answer{Question: s.current, Correct: correct})
+	return correct
+}
+
+// Answers возвращает данные ответы по порядку.
+func (s *Session) Answers() []Answer {
+	return append([]Answer(nil), s.answers...)
+}
+
+func (s *Session) record(a Answer) {
+	q := s.bank.Questions[a.Question]
+	s.answers = append(s.answers, a)
+	s.asked[a.Question] = true
+
+	next := q.Difficulty() - 1
+	if a.Correct {
+		next = q.Difficulty() + 1
+	}
+	s.target[q.Topic] = max(0, min(next, len(Levels)-1))
+	s.current = s.pick()
+}
+
+// pick выбирает следующий вопрос или возвращает -1, если тест окончен.
+func (s *Session) pick() int {
+	if len(s.answers) >= s.Length() {
+		return -1
+	}
+
+	asked := make(map[string]int)
+	left := make(map[string][]int)
+	for i, q := range s.bank.Questions {
+		if s.asked[i] {
+			asked[q.Topic]++
+		} else {
+			left[q.Topic] = append(left[q.Topic], i)
+		}
+	}
+
+	var topics []string
+	for _, id := range s.bank.topicIDs() {
+		if len(left[id]) == 0 {
+			continue
+		}
+		if len(topics) > 0 && asked[id] > asked[topics[0]] {
+			continue
+		}
+		if len(topics) > 0 && asked[id] < asked[topics[0]] {
+			topics = topics[:0]
+		}
+		topics = append(topics, id)
+	}
+	if len(topics) == 0 {
+		return -1
+	}
+	topic := topics[s.rng.Intn(len(topics))]
+
+	target, ok := s.target[topic]
+	if !ok {
+		target = startDifficulty
+	}
+	var candidates []int
+	best := len(Levels)
+	for _, i := range left[topic] {
+		d := abs(s.bank.Questions[i].Difficulty() - target)
+		if d < best {
+			best = d
+			candidates = candidates[:0]
+		}
+		if d == best {
+			candidates = append(candidates, i)
+		}
+	}
+	return candidates[s.rng.Intn(len(candidates))]
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// TopicResult — оценка уровня по одной теме.
+type TopicResult struct {
+	Topic   string // ID темы, пусто — вопросы без темы
+	Level   string
+	Correct int
+	Total   int
+}
+
+type Result struct {
+	Correct int
+	Total   int
+	Topics  []TopicResult // в порядке тем банка, только темы с заданными вопросами
+}
+
+// Level возвращает оценку по теме и false, если вопросов по ней не было.
+func (r Result) Level(topic string) (string, bool) {
+	for _, t := range r.Topics {
+		if t.Topic == topic {
+			return t.Level, true
+		}
+	}
+	return "", false
+}
+
+// Result оценивает уровень по каждой теме: это самая высокая сложность,
+// на которой верных ответов не меньше неверных и хотя бы один верный.
+// Если такой нет — начальный уровень.
+func (s *Session) Result() Result {
+	type tally struct{ correct, wrong []int }
+	tallies := make(map[string]*tally)
+	var r Result
+	for _, a := range s.answers {
+		q := s.bank.Questions[a.Question]
+		t := tallies[q.Topic]
+		if t == nil {
+			t = &tally{correct: make([]int, len(Levels)), wrong: make([]int, len(Levels))}
+			tallies[q.Topic] = t
+		}
+		if a.Correct {
+			t.correct[q.Difficulty()]++
+			r.Correct++
+		} else {
+			t.wrong[q.Difficulty()]++
+		}
+		r.Total++
+	}
+
+	for _, id := range s.bank.topicIDs() {
+		t := tallies[id]
+		if t == nil {
+			continue
+		}
+		tr := TopicResult{Topic: id, Level: Levels[0]}
+		for d := range Levels {
+			tr.Correct += t.correct[d]
+			tr.Total += t.correct[d] + t.wrong[d]
+			if t.correct[d] > 0 && t.correct[d] >= t.wrong[d] {
+				tr.Level = Levels[d]
+			}
+		}
+		r.Topics = append(r.Topics, tr)
+	}
+	return r
+}
@@ -0,0 +1,141 @@
+package quiz
+
+import "testing"
+
+func question(topic string, difficulty int) Question {
+	return Question{
+		Question: topic + " " + Levels[difficulty],
+		Options:  []string{"верно", "неверно"},
+		Answer:   0,
+		Level:    Levels[difficulty],
+		Topic:    topic,
+	}
+}
+
+// testBank — по perLevel вопросов каждой сложности в каждой теме, темы по порядку.
+func testBank(perLevel int, topics ...string) *Bank {
+	bank := &Bank{Track: "test", Title: "Тест"}
+	for _, id := range topics {
+		bank.Topics = append(bank.Topics, Topic{ID: id, Title: id})
+		for d := range Levels {
+			for i := 0; i < perLevel; i++ {
+				bank.Questions = append(bank.Questions, question(id, d))
+			}
+		}
+	}
+	return bank
+}
+
+func answer(s *Session, correct bool) {
+	if correct {
+		s.Answer(0)
+	} else {
+		s.Answer(1)
+	}
+}
+
+func currentDifficulty(t *testing.T, s *Session) int {
+	t.Helper()
+	_, q, ok := s.Current()
+	if !ok {
+		t.Fatal("тест закончился раньше времени")
+	}
+	return q.Difficulty()
+}
+
+func TestSessionStepsDifficulty(t *testing.T) {
+	bank := testBank(3, "syntax")
+	bank.Length = 6
+	s := NewSession(bank, 1)
+
+	steps := []struct {
+		correct bool
+		want    int // сложность следующего вопроса
+	}{
+		{true, 2},  // со среднего вверх
+		{true, 2},  // выше продвинутого не поднимается
+		{false, 1}, // с продвинутого вниз
+		{false, 0},
+		{false, 0}, // ниже начального не опускается
+	}
+	if d := currentDifficulty(t, s); d != startDifficulty {
+		t.Fatalf("первый вопрос сложности %d, ожидалась %d", d, startDifficulty)
+	}
+	for i, step := range steps {
+		answer(s, step.correct)
+		if d := currentDifficulty(t, s); d != step.want {
+			t.Fatalf("после ответа %d (верный: %v) сложность %d, ожидалась %d", i+1, step.correct, d, step.want)
+		}
+	}
+	answer(s, true)
+	if !s.Done() {
+		t.Fatal("тест не закончился после Length ответов")
+	}
+}
+
+func TestResumeMatchesLiveSession(t *testing.T) {
+	bank := testBank(2, "syntax", "types", "")
+	const seed = 42
+	live := NewSession(bank, seed)
+
+	for i := 0; !live.Done(); i++ {
+		resumed := Resume(bank, seed, live.Answers())
+		want, _, _ := live.Current()
+		got, _, ok := resumed.Current()
+		if !ok || got != want {
+			t.Fatalf("после %d ответов: восстановленная сессия задаёт вопрос %d, живая — %d", i, got, want)
+		}
+		answer(live, i%3 != 0)
+	}
+	if resumed := Resume(bank, seed, live.Answers()); !resumed.Done() {
+		t.Fatal("восстановленная по всем ответам сессия не окончена")
+	}
+}
+
+func TestResumeSkipsUnknownQuestions(t *testing.T) {
+	bank := testBank(2, "syntax")
+	live := NewSession(bank, 7)
+	first, _, _ := live.Current()
+	answer(live, true)
+
+	answers := append([]Answer{{Question: len(bank.Questions)}, {Question: -1}}, live.Answers()...)
+	answers = append(answers, Answer{Question: first, Correct: false}) // повтор
+	resumed := Resume(bank, 7, answers)
+
+	if got := resumed.Answers(); len(got) != 1 || got[0].Question != first {
+		t.Fatalf("ответы восстановленной сессии: %+v", got)
+	}
+	want, _, _ := live.Current()
+	if got, _, _ := resumed.Current(); got != want {
+		t.Fatalf("восстановленная сессия задаёт вопрос %d, живая — %d", got, want)
+	}
+}
+
+func TestResultPerTopicLevels(t *testing.T) {
+	// По одному вопросу каждой сложности: индексы тем a — 0..2, b — 3..5, c — 6..8
+	bank := testBank(1, "a", "b", "c")
+	s := Resume(bank, 1, []Answer{
+		{Question: 0, Correct: true},  // a, начальный
+		{Question: 1, Correct: true},  // a, средний
+		{Question: 2, Correct: false}, // a, продвинутый
+		{Question: 4, Correct: false}, // b, средний
+		{Question: 3, Correct: false}, // b, начальный
+	})
+
+	r := s.Result()
+	if r.Correct != 2 || r.Total != 5 {
+		t.Fatalf("итог %d из %d, ожидалось 2 из 5", r.Correct, r.Total)
+	}
+	if len(r.Topics) != 2 || r.Topics[0].Topic != "a" || r.Topics[1].Topic != "b" {
+		t.Fatalf("темы результата: %+v", r.Topics)
+	}
+	if a := r.Topics[0]; a.Level != Levels[1] || a.Correct != 2 || a.Total != 3 {
+		t.Fatalf("тема a: %+v", a)
+	}
+	if b := r.Topics[1]; b.Level != Levels[0] || b.Correct != 0 || b.Total != 2 {
+		t.Fatalf("тема b: %+v", b)
+	}
+	if _, ok := r.Level("c"); ok {
+		t.Fatal("у темы без вопросов есть уровень")
+	}
+}
@@ -0,0 +1,259 @@
+package quiz
+
+import (
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Встроенные банки вопросов используются, если каталог с файлами не задан.
+//
+//go:embed banks/*.yaml
+var embedded embed.FS
+
+// Уровни, которыми размечаются вопросы, от простого к сложному. Совпадают
+// с уровнями курсов.
+var Levels = []string{"Начальный", "Средний", "Продвинутый"}
+
+// DefaultLength — сколько вопросов задаётся, если длина теста не указана.
+const DefaultLength = 10
+
+type Question struct {
+	Question string   `yaml:"question" json:"question"`
+	Options  []string `yaml:"options" json:"options"`
+	Answer   int      `yaml:"answer" json:"answer"` // индекс правильного варианта, с нуля
+	Level    string   `yaml:"level" json:"level"`   // сложность вопроса
+	Topic    string   `yaml:"topic" json:"topic"`   // ID темы, пусто — без темы
+}
+
+// Difficulty возвращает сложность вопроса как номер уровня в Levels.
+func (q Question) Difficulty() int {
+	for i, level := range Levels {
+		if level == q.Level {
+			return i
+		}
+	}
+	return 0
+}
+
+// Topic — тема, по которой тест оценивает уровень отдельно, например
+// конкурентность в Go. Курсы ссылаются на тему по ID.
+type Topic struct {
+	ID    string `yaml:"id" json:"id"`
+	Title string `yaml:"title" json:"title"`
+	// Titles — название на других языках, ключ — код языка
+	Titles map[string]string `yaml:"titles" json:"titles"`
+}
+
+// Name возвращает название темы на языке lang или основное название.
+func (t Topic) Name(lang string) string {
+	if title := t.Titles[lang]; title != "" {
+		return title
+	}
+	return t.Title
+}
+
+// Bank — вступительный тест для одного направления (track), например go или python.
+type Bank struct {
+	Track     string     `yaml:"track" json:"track"`
+	Title     string     `yaml:"title" json:"title"`
+	Length    int        `yaml:"length" json:"length"` // вопросов в тесте, 0 — DefaultLength
+	Topics    []Topic    `yaml:"topics" json:"topics"`
+	Questions []Question `yaml:"questions" json:"questions"`
+}
+
+// Banks — набор банков вопросов, по одному на направление.
+type Banks struct {
+	byTrack map[string]*Bank
+	order   []string
+}
+
+// Load читает банки из каталога dir (*.yaml, *.yml, *.json).
+// Пустой dir означает встроенные банки.
+func Load(dir string) (*Banks, error) {
+	if dir == "" {
+		sub, err := fs.Sub(embedded, "banks")
+		if err != nil {
+			return nil, err
+		}
+		return LoadFS(sub)
+	}
+	return LoadFS(os.DirFS(dir))
+}
+
+// LoadFS читает и проверяет все банки из корня fsys.
+func LoadFS(fsys fs.FS) (*Banks, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, fmt.Errorf("read question banks: %w", err)
+	}
+
+	banks := &Banks{byTrack: make(map[string]*Bank)}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		name := entry.Name()
+		ext := strings.ToLower(path.Ext(name))
+		if ext != ".yaml" && ext != ".yml" && ext != ".json" {
+			continue
+		}
+
+		data, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return nil, fmt.Errorf("read %s: %w", name, err)
+		}
+
+		var bank Bank
+		if ext == ".json" {
+			err = json.Unmarshal(data, &bank)
+		} else {
+			err = yaml.Unmarshal(data, &bank)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("parse %s: %w", name, err)
+		}
+		if err := bank.Validate(); err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		if bank.Title == "" {
+			bank.Title = bank.Track
+		}
+		if _, dup := banks.byTrack[bank.Track]; dup {
+			return nil, fmt.Errorf("%s: duplicate track %q", name, bank.Track)
+		}
+
+		banks.byTrack[bank.Track] = &bank
+		banks.order = append(banks.order, bank.Track)
+	}
+
+	if len(banks.order) == 0 {
+		return nil, errors.New("no question banks found")
+	}
+	sort.Strings(banks.order)
+	return banks, nil
+}
+
+// Validate проверяет, что тест можно пройти: у каждого вопроса есть текст,
+// не меньше двух вариантов, правильный ответ среди них и известная тема.
+func (b *Bank) Validate() error {
+	if b.Track == "" {
+		return errors.New("track is required")
+	}
+	if len(b.Questions) == 0 {
+		return fmt.Errorf("track %q has no questions", b.Track)
+	}
+	if b.Length < 0 {
+		return fmt.Errorf("length %d is negative", b.Length)
+	}
+
+	topics := make(map[string]bool, len(b.Topics))
+	for i, t := range b.Topics {
+		if t.ID == "" {
+			return fmt.Errorf("topic %d: id is required", i+1)
+		}
+		if topics[t.ID] {
+			return fmt.Errorf("topic %d: duplicate id %q", i+1, t.ID)
+		}
+		topics[t.ID] = true
+	}
+
+	for i, q := range b.Questions {
+		if strings.TrimSpace(q.Question) == "" {
+			return fmt.Errorf("question %d: text is empty", i+1)
+		}
+		if len(q.Options) < 2 {
+			return fmt.Errorf("question %d: need at least 2 options, got %d", i+1, len(q.Options))
+		}
+		if q.Answer < 0 || q.Answer >= len(q.Options) {
+			return fmt.Errorf("question %d: answer %d is out of range 0..%d", i+1, q.Answer, len(q.Options)-1)
+		}
+		if !validLevel(q.Level) {
+			return fmt.Errorf("question %d: unknown level %q", i+1, q.Level)
+		}
+		if q.Topic != "" && !topics[q.Topic] {
+			return fmt.Errorf("question %d: unknown topic %q", i+1, q.Topic)
+		}
+	}
+	return nil
+}
+
+// TestLength возвращает, сколько вопросов задаётся в тесте.
+func (b *Bank) TestLength() int {
+	n := b.Length
+	if n == 0 {
+		n = DefaultLength
+	}
+	return min(n, len(b.Questions))
+}
+
+func (b *Bank) Topic(id string) (Topic, bool) {
+	for _, t := range b.Topics {
+		if t.ID == id {
+			return t, true
+		}
+	}
+	return Topic{}, false
+}
+
+// TopicName возвращает название темы на языке lang. Вопросы без темы
+// называются по направлению.
+func (b *Bank) TopicName(id, lang string) string {
+	if t, ok := b.Topic(id); ok {
+		return t.Name(lang)
+	}
+	if id == "" {
+		return b.Title
+	}
+	return id
+}
+
+// topicIDs возвращает темы, по которым есть вопросы, в порядке объявления.
+// Вопросы без темы идут последними.
+func (b *Bank) topicIDs() []string {
+	used := make(map[string]bool)
+	for _, q := range b.Questions {
+		used[q.Topic] = true
+	}
+	var ids []string
+	for _, t := range b.Topics {
+		if used[t.ID] {
+			ids = append(ids, t.ID)
+		}
+	}
+	if used[""] {
+		ids = append(ids, "")
+	}
+	return ids
+}
+
+func validLevel(level string) bool {
+	for _, l := range Levels {
+		if l == level {
+			return true
+		}
+	}
+	return false
+}
+
+func (b *Banks) Get(track string) (*Bank, bool) {
+	bank, ok := b.byTrack[track]
+	return bank, ok
+}
+
+// List возвращает банки, отсортированные по направлению.
+func (b *Banks) List() []*Bank {
+	list := make([]*Bank, 0, len(b.order))
+	for _, track := range b.order {
+		list = append(list, b.byTrack[track])
+	}
+	return list
+}
@@ -0,0 +1,165 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"tgbot/internal/entities"
+	"tgbot/internal/storage"
+)
+
+const (
+	// Сколько задач забирается из базы за один проход
+	batchSize = 50
+	// После стольких неудачных попыток задача помечается failed
+	maxAttempts = 5
+	// Пауза перед первой повторной попыткой, дальше удваивается
+	retryBackoff = time.Minute
+	// Сколько взятая задача закреплена за экземпляром бота. Если он упал,
+	// не выполнив её, задачу после этого возьмёт другой
+	claimTimeout = 5 * time.Minute
+)
+
+// Clock — источник текущего времени. В тестах подменяется FakeClock.
+type Clock interface {
+	Now() time.Time
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time { return time.Now() }
+
+// RealClock возвращает системные часы.
+func RealClock() Clock { return realClock{} }
+
+// FakeClock стоит на месте, пока его не передвинут через Advance.
+type FakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func NewFakeClock(now time.Time) *FakeClock {
+	return &FakeClock{now: now}
+}
+
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// Handler выполняет задачу. Ошибка означает, что задачу нужно повторить позже.
+type Handler func(ctx context.Context, job entities.ScheduledJob) error
+
+// Scheduler хранит отложенные задачи в базе, поэтому они переживают
+// перезапуск бота. Задачи выполняет цикл Run; несколько экземпляров бота на
+// одной базе делят задачи между собой, каждую выполняет один из них.
+type Scheduler struct {
+	jobs     storage.JobRepository
+	clock    Clock
+	handlers map[string]Handler
+}
+
+func New(jobs storage.JobRepository, clock Clock) *Scheduler {
+	return &Scheduler{
+		jobs:     jobs,
+		clock:    clock,
+		handlers: make(map[string]Handler),
+	}
+}
+
+// Handle регистрирует обработчик задач вида kind. Вызывается до Run.
+func (s *Scheduler) Handle(kind string, h Handler) {
+	s.handlers[kind] = h
+}
+
+// Now возвращает время по часам планировщика в UTC: SQLite сравнивает
+// время как строки, поэтому все отметки должны быть в одной зоне.
+func (s *Scheduler) Now() time.Time {
+	return s.clock.Now().UTC()
+}
+
+// Schedule ставит задачу на выполнение через delay.
+func (s *Scheduler) Schedule(ctx context.Context, kind string, chatID int64, payload string, delay time.Duration) error {
+	now := s.Now()
+	_, err := s.jobs.ScheduleJob(ctx, entities.ScheduledJob{
+		Kind:    kind,
+		ChatID:  chatID,
+		Payload: payload,
+		RunAt:   now.Add(delay),
+	}, now)
+	return err
+}
+
+// Cancel отменяет ещё не выполненные задачи вида kind для чата.
+func (s *Scheduler) Cancel(ctx context.Context, kind string, chatID int64, payload string) error {
+	return s.jobs.CancelJobs(ctx, chatID, kind, payload, s.Now())
+}
+
+// RunDue выполняет задачи, время которых наступило (не больше batchSize
+// за вызов), и возвращает число обработанных задач. После отмены ctx
+// новые задачи не начинаются; начатая задача доводится до конца, чтобы
+// её результат успел записаться в базу. Взятые, но не начатые задачи
+// выполнятся после claimTimeout.
+func (s *Scheduler) RunDue(ctx context.Context) (int, error) {
+	now := s.Now()
+	jobs, err := s.jobs.ClaimDueJobs(ctx, now, now.Add(claimTimeout), batchSize)
+	if err != nil {
+		return 0, err
+	}
+	for i, job := range jobs {
+		if ctx.Err() != nil {
+			return i, ctx.Err()
+		}
+		s.run(context.WithoutCancel(ctx), job, now)
+	}
+	return len(jobs), nil
+}
+
+func (s *Scheduler) run(ctx context.Context, job entities.ScheduledJob, now time.Time) {
+	var err error
+	if h, ok := s.handlers[job.Kind]; ok {
+		err = h(ctx, job)
+	} else {
+		err = fmt.Errorf("no handler for job kind %q", job.Kind)
+	}
+
+	switch {
+	case err == nil:
+		err = s.jobs.CompleteJob(ctx, job.ID, now)
+	case job.Attempts+1 >= maxAttempts:
+		log.Printf("Задача %d (%s) не выполнена после %d попыток: %v", job.ID, job.Kind, job.Attempts+1, err)
+		err = s.jobs.FailJob(ctx, job.ID, err.Error(), now)
+	default:
+		log.Printf("Задача %d (%s) не выполнена, повторим позже: %v", job.ID, job.Kind, err)
+		err = s.jobs.RetryJob(ctx, job.ID, now.Add(retryBackoff<<job.Attempts), err.Error(), now)
+	}
+	if err != nil {
+		log.Printf("Ошибка при обновлении задачи %d: %v", job.ID, err)
+	}
+}
+
+// Run проверяет задачи каждые interval, пока не отменён ctx.
+func (s *Scheduler) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if _, err := s.RunDue(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("Ошибка при выполнении отложенных задач: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"tgbot/internal/entities"
+	"tgbot/internal/storage"
+)
+
+func newTestStore(t *testing.T) *storage.Store {
+	t.Helper()
+	store, err := storage.InitDB(context.Background(), t.TempDir()+"/jobs.db")
+	if err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+func runDue(t *testing.T, s *Scheduler) int {
+	t.Helper()
+	n, err := s.RunDue(context.Background())
+	if err != nil {
+		t.Fatalf("RunDue: %v", err)
+	}
+	return n
+}
+
+func TestRunDueInRunAtOrder(t *testing.T) {
+	ctx := context.Background()
+	clock := NewFakeClock(time.Date(2026, 9, 1, 10, 0, 0, 0, time.UTC))
+	s := New(newTestStore(t).Jobs, clock)
+
+	var ran []string
+	s.Handle("test", func(ctx context.Context, job entities.ScheduledJob) error {
+		ran = append(ran, job.Payload)
+		return nil
+	})
+	for _, j := range []struct {
+		payload string
+		delay   time.Duration
+	}{{"third", 3 * time.Minute}, {"first", time.Minute}, {"later", 10 * time.Minute}, {"second", 2 * time.Minute}} {
+		if err := s.Schedule(ctx, "test", 1, j.payload, j.delay); err != nil {
+			t.Fatalf("Schedule: %v", err)
+		}
+	}
+
+	if n := runDue(t, s); n != 0 {
+		t.Fatalf("до срока выполнено задач: %d", n)
+	}
+	clock.Advance(5 * time.Minute)
+	if n := runDue(t, s); n != 3 {
+		t.Fatalf("выполнено задач: %d, ожидалось 3", n)
+	}
+	if want := []string{"first", "second", "third"}; len(ran) != len(want) || ran[0] != want[0] || ran[1] != want[1] || ran[2] != want[2] {
+		t.Fatalf("порядок выполнения %v, ожидался %v", ran, want)
+	}
+	// Выполненные задачи не повторяются, а задача на потом ждёт своего времени
+	if n := runDue(t, s); n != 0 {
+		t.Fatalf("повторно выполнено задач: %d", n)
+	}
+	clock.Advance(5 * time.Minute)
+	if n := runDue(t, s); n != 1 || ran[3] != "later" {
+		t.Fatalf("выполнено %d, порядок %v", n, ran)
+	}
+}
+
+func TestRetryWithBackoffUntilMaxAttempts(t *testing.T) {
+	clock := NewFakeClock(time.Date(2026, 9, 1, 10, 0, 0, 0, time.UTC))
+	s := New(newTestStore(t).Jobs, clock)
+
+	var attempts []int
+	s.Handle("flaky", func(ctx context.Context, job entities.ScheduledJob) error {
+		attempts = append(attempts, job.Attempts)
+		return errors.New("telegram is down")
+	})
+	if err := s.Schedule(context.Background(), "flaky", 1, "", 0); err != nil {
+		t.Fatalf("Schedule: %v", err)
+	}
+
+	if n := runDue(t, s); n != 1 {
+		t.Fatalf("первая попытка: выполнено %d", n)
+	}
+	// Пауза перед повтором удваивается: 1, 2, 4, 8 минут
+	for retry := 0; retry < maxAttempts-1; retry++ {
+		backoff := retryBackoff << retry
+		clock.Advance(backoff - time.Second)
+		if n := runDue(t, s); n != 0 {
+			t.Fatalf("повтор %d раньше паузы %s", retry+1, backoff)
+		}
+		clock.Advance(time.Second)
+		if n := runDue(t, s); n != 1 {
+			t.Fatalf("повтор %d после паузы %s не выполнен", retry+1, backoff)
+		}
+	}
+	if len(attempts) != maxAttempts {
+		t.Fatalf("попыток: %d, ожидалось %d", len(attempts), maxAttempts)
+	}
+	for i, a := range attempts {
+		if a != i {
+			t.Fatalf("попытка %d видела Attempts=%d", i+1, a)
+		}
+	}
+
+	// После maxAttempts задача помечена failed и больше не выполняется
+	clock.Advance(24 * time.Hour)
+	if n := runDue(t, s); n != 0 {
+		t.Fatalf("после %d попыток задача выполнилась снова", maxAttempts)
+	}
+}
+
+func TestRetrySucceedsAfterFailure(t *testing.T) {
+	clock := NewFakeClock(time.Date(2026, 9, 1, 10, 0, 0, 0, time.UTC))
+	s := New(newTestStore(t).Jobs, clock)
+
+	calls := 0
+	s.Handle("flaky", func(ctx context.Context, job entities.ScheduledJob) error {
+		calls++
+		if calls == 1 {
+			return errors.New("temporary")
+		}
+		return nil
+	})
+	if err := s.Schedule(context.Background(), "flaky", 1, "", 0); err != nil {
+		t.Fatalf("Schedule: %v", err)
+	}
+
+	runDue(t, s)
+	clock.Advance(retryBackoff)
+	runDue(t, s)
+	clock.Advance(24 * time.Hour)
+	runDue(t, s)
+	if calls != 2 {
+		t.Fatalf("вызовов обработчика: %d, ожидалось 2", calls)
+	}
+}
+
+func TestClaimedJobRunsOnce(t *testing.T) {
+	store := newTestStore(t)
+	clock := NewFakeClock(time.Date(2026, 9, 1, 10, 0, 0, 0, time.UTC))
+	first := New(store.Jobs, clock)
+	second := New(store.Jobs, clock)
+
+	calls := 0
+	handler := func(ctx context.Context, job entities.ScheduledJob) error {
+		calls++
+		return nil
+	}
+	second.Handle("test", handler)
+
+	var whileRunning, afterTimeout int
+	first.Handle("test", func(ctx context.Context, job entities.ScheduledJob) error {
+		calls++
+		// Пока первый экземпляр выполняет задачу, второй её не берёт...
+		whileRunning = runDue(t, second)
+		// ...но забирает, если первый не уложился в claimTimeout
+		clock.Advance(claimTimeout)
+		afterTimeout = runDue(t, second)
+		return nil
+	})
+	if err := first.Schedule(context.Background(), "test", 1, "", 0); err != nil {
+		t.Fatalf("Schedule: %v", err)
+	}
+
+	if n := runDue(t, first); n != 1 {
+		t.Fatalf("первый экземпляр выполнил %d задач", n)
+	}
+	if whileRunning != 0 || afterTimeout != 1 || calls != 2 {
+		t.Fatalf("второй экземпляр: во время выполнения %d, после таймаута %d, всего вызовов %d", whileRunning, afterTimeout, calls)
+	}
+}
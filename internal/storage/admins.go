@@ -0,0 +1,94 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"tgbot/internal/entities"
+)
+
+// GetAdminRole возвращает роль сотрудника или пустую роль, если userID не сотрудник.
+func (r *sqlRepo) GetAdminRole(ctx context.Context, userID int64) (entities.Role, error) {
+	var role string
+	err := r.queryRow(ctx, `SELECT role FROM admins WHERE user_id = ?`, userID).Scan(&role)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("query admin role: %w", err)
+	}
+	return entities.Role(role), nil
+}
+
+// ListAdmins возвращает всех сотрудников с их ролями.
+func (r *sqlRepo) ListAdmins(ctx context.Context) (map[int64]entities.Role, error) {
+	rows, err := r.query(ctx, `SELECT user_id, role FROM admins`)
+	if err != nil {
+		return nil, fmt.Errorf("query admins: %w", err)
+	}
+	defer rows.Close()
+
+	admins := make(map[int64]entities.Role)
+	for rows.Next() {
+		var userID int64
+		var role string
+		if err := rows.Scan(&userID, &role); err != nil {
+			return nil, fmt.Errorf("scan admin: %w", err)
+		}
+		admins[userID] = entities.Role(role)
+	}
+	return admins, rows.Err()
+}
+
+func (r *sqlRepo) SaveAdmin(ctx context.Context, userID int64, role entities.Role) error {
+	query := `
+	INSERT INTO admins(user_id, role, created_at)
+	VALUES (?, ?, ?)
+	ON CONFLICT(user_id) DO UPDATE SET role = excluded.role;`
+	_, err := r.exec(ctx, query, userID, string(role), time.Now())
+	if err != nil {
+		return fmt.Errorf("save admin: %w", err)
+	}
+	return nil
+}
+
+// ReplaceAdmins делает admins полным списком сотрудников: добавляет новых,
+// меняет роли и удаляет тех, кого в списке нет. Всё выполняется в одной
+// транзакции, поэтому при ошибке остаётся прежний список.
+func (r *sqlRepo) ReplaceAdmins(ctx context.Context, admins map[int64]entities.Role) error {
+	return r.inTx(ctx, func(tx *sql.Tx) error {
+		query := `DELETE FROM admins`
+		args := make([]interface{}, 0, len(admins))
+		for userID := range admins {
+			args = append(args, userID)
+		}
+		if len(args) > 0 {
+			query += ` WHERE user_id NOT IN (?` + strings.Repeat(`, ?`, len(args)-1) + `)`
+		}
+		if _, err := tx.ExecContext(ctx, r.dialect.rebind(query), args...); err != nil {
+			return fmt.Errorf("revoke admins: %w", err)
+		}
+
+		for userID, role := range admins {
+			_, err := tx.ExecContext(ctx, r.dialect.rebind(`
+			INSERT INTO admins(user_id, role, created_at)
+			VALUES (?, ?, ?)
+			ON CONFLICT(user_id) DO UPDATE SET role = excluded.role`), userID, string(role), time.Now())
+			if err != nil {
+				return fmt.Errorf("save admin %d: %w", userID, err)
+			}
+		}
+		return nil
+	})
+}
+
+func (r *sqlRepo) SaveAuditEntry(ctx context.Context, userID int64, command string, allowed bool) error {
+	query := `
+	INSERT INTO audit_log(user_id, command, allowed, timestamp)
+	VALUES (?, ?, ?, ?);`
+	_, err := r.exec(ctx, query, userID, command, allowed, time.Now())
+	return err
+}
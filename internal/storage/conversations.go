@@ -0,0 +1,40 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	"tgbot/internal/entities"
+)
+
+func (r *sqlRepo) SaveMessage(ctx context.Context, userID int64, role, message string) error {
+	query := `
+	INSERT INTO conversations(user_id, role, message, timestamp)
+	VALUES (?, ?, ?, ?);`
+	_, err := r.exec(ctx, query, userID, role, message, time.Now())
+	return err
+}
+
+func (r *sqlRepo) GetConversationHistory(ctx context.Context, userID int64) ([]entities.Message, error) {
+	query := `SELECT role, message, timestamp FROM conversations WHERE user_id = ? ORDER BY timestamp ASC`
+	rows, err := r.query(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var history []entities.Message
+	for rows.Next() {
+		var msg entities.Message
+		var ts time.Time
+		if err := rows.Scan(&msg.Role, &msg.Text, &ts); err != nil {
+			return nil, err
+		}
+		msg.Timestamp = ts.Format("2006-01-02 15:04:05")
+		history = append(history, msg)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return history, nil
+}
@@ -0,0 +1,228 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"tgbot/internal/entities"
+)
+
+func (r *sqlRepo) SeedCourses(ctx context.Context) error {
+	var count int
+	if err := r.queryRow(ctx, "SELECT COUNT(*) FROM courses").Scan(&count); err != nil {
+		return fmt.Errorf("count courses: %w", err)
+	}
+	if count > 0 {
+		return nil
+	}
+
+	courses := []entities.Course{
+		{
+			Name:        "Go для начинающих",
+			Track:       "go",
+			Level:       "Начальный",
+			Topic:       "basics",
+			Teacher:     "Иван Иванов",
+			Schedule:    "Понедельно, 18:00-20:00",
+			Description: "Основы языка Go. Изучение синтаксиса и базовых структур данных.",
+			Price:       9900.00,
+			Capacity:    15,
+			Translations: map[string]entities.CourseTranslation{
+				"en": {Name: "Go for Beginners", Description: "Go language basics: syntax and core data structures."},
+				"kk": {Name: "Бастаушыларға арналған Go", Description: "Go тілінің негіздері: синтаксис және негізгі деректер құрылымдары."},
+			},
+		},
+		{
+			Name:        "Go для продвинутых",
+			Track:       "go",
+			Level:       "Продвинутый",
+			Topic:       "concurrency",
+			Teacher:     "Алексей Петров",
+			Schedule:    "Вторник и четверг, 19:00-21:00",
+			Description: "Продвинутые техники работы с Go, асинхронное программирование, паттерны проектирования.",
+			Price:       14900.00,
+			Capacity:    12,
+			Translations: map[string]entities.CourseTranslation{
+				"en": {Name: "Advanced Go", Description: "Advanced Go techniques, concurrency and design patterns."},
+				"kk": {Name: "Тәжірибелілерге арналған Go", Description: "Go-мен жұмыстың озық тәсілдері, асинхронды бағдарламалау, жобалау үлгілері."},
+			},
+		},
+		{
+			Name:        "Python для начинающих",
+			Track:       "python",
+			Level:       "Начальный",
+			Topic:       "basics",
+			Teacher:     "Мария Сидорова",
+			Schedule:    "Среда, 17:00-19:00",
+			Description: "Основы Python. Создание простых программ и работа с библиотеками.",
+			Price:       8900.00,
+			Capacity:    15,
+			Translations: map[string]entities.CourseTranslation{
+				"en": {Name: "Python for Beginners", Description: "Python basics: writing simple programs and working with libraries."},
+				"kk": {Name: "Бастаушыларға арналған Python", Description: "Python негіздері: қарапайым бағдарламалар жазу және кітапханалармен жұмыс."},
+			},
+		},
+		{
+			Name:        "Основы программирования на C++",
+			Track:       "cpp",
+			Level:       "Начальный",
+			Topic:       "basics",
+			Teacher:     "Олег Никитин",
+			Schedule:    "Понедельник, 10:00-12:00",
+			Description: "Базовые конструкции языка C++, типы данных, работа с памятью.",
+			Price:       9200.00,
+			Capacity:    15,
+			Translations: map[string]entities.CourseTranslation{
+				"en": {Name: "C++ Programming Fundamentals", Description: "Core C++ constructs, data types and memory management."},
+				"kk": {Name: "C++ тілінде бағдарламалау негіздері", Description: "C++ тілінің негізгі құрылымдары, деректер типтері, жадпен жұмыс."},
+			},
+		},
+		{
+			Name:        "Разработка веб-приложений на Django",
+			Track:       "python",
+			Level:       "Средний",
+			Topic:       "web",
+			Teacher:     "Ирина Лебедева",
+			Schedule:    "Среда, 14:00-16:00",
+			Description: "Работа с Django, маршрутизация, шаблоны, базы данных.",
+			Price:       13500.00,
+			Capacity:    12,
+			Translations: map[string]entities.CourseTranslation{
+				"en": {Name: "Web Development with Django", Description: "Working with Django: routing, templates and databases."},
+				"kk": {Name: "Django-да веб-қосымшалар әзірлеу", Description: "Django-мен жұмыс: маршруттау, үлгілер, деректер қорлары."},
+			},
+		},
+		{
+			Name:        "Архитектура микросервисов на Go",
+			Track:       "go",
+			Level:       "Продвинутый",
+			Topic:       "services",
+			Teacher:     "Дмитрий Волков",
+			Schedule:    "Пятница, 18:00-20:00",
+			Description: "gRPC, Docker, Kubernetes и построение масштабируемых сервисов.",
+			Price:       18900.00,
+			Capacity:    10,
+			Translations: map[string]entities.CourseTranslation{
+				"en": {Name: "Microservice Architecture in Go", Description: "gRPC, Docker, Kubernetes and building scalable services."},
+				"kk": {Name: "Go тіліндегі микросервистер архитектурасы", Description: "gRPC, Docker, Kubernetes және ауқымды сервистер құру."},
+			},
+		},
+	}
+
+	for _, course := range courses {
+		if _, err := r.CreateCourse(ctx, course); err != nil {
+			return fmt.Errorf("seed course %q: %w", course.Name, err)
+		}
+	}
+	return nil
+}
+
+// GetCourses возвращает курсы, открытые для записи, вместе с переводами.
+// Архивные курсы не возвращаются.
+func (r *sqlRepo) GetCourses(ctx context.Context) ([]entities.Course, error) {
+	rows, err := r.query(ctx, "SELECT id, name, COALESCE(track, ''), level, COALESCE(topic, ''), teacher, schedule, description, price, capacity FROM courses WHERE archived = ? ORDER BY id", false)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var courses []entities.Course
+	for rows.Next() {
+		var c entities.Course
+		if err := rows.Scan(&c.ID, &c.Name, &c.Track, &c.Level, &c.Topic, &c.Teacher, &c.Schedule, &c.Description, &c.Price, &c.Capacity); err != nil {
+			return nil, err
+		}
+		courses = append(courses, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	translations, err := r.courseTranslations(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for i := range courses {
+		courses[i].Translations = translations[courses[i].ID]
+	}
+	return courses, nil
+}
+
+func (r *sqlRepo) courseTranslations(ctx context.Context) (map[int64]map[string]entities.CourseTranslation, error) {
+	rows, err := r.query(ctx, "SELECT course_id, language, name, description FROM course_translations")
+	if err != nil {
+		return nil, fmt.Errorf("query course translations: %w", err)
+	}
+	defer rows.Close()
+
+	translations := make(map[int64]map[string]entities.CourseTranslation)
+	for rows.Next() {
+		var courseID int64
+		var lang string
+		var t entities.CourseTranslation
+		if err := rows.Scan(&courseID, &lang, &t.Name, &t.Description); err != nil {
+			return nil, err
+		}
+		if translations[courseID] == nil {
+			translations[courseID] = make(map[string]entities.CourseTranslation)
+		}
+		translations[courseID][lang] = t
+	}
+	return translations, rows.Err()
+}
+
+// saveCourseTranslations заменяет переводы курса переданными.
+func (r *sqlRepo) saveCourseTranslations(ctx context.Context, courseID int64, translations map[string]entities.CourseTranslation) error {
+	return r.inTx(ctx, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, r.dialect.rebind("DELETE FROM course_translations WHERE course_id = ?"), courseID); err != nil {
+			return err
+		}
+		for lang, t := range translations {
+			if t.Name == "" && t.Description == "" {
+				continue
+			}
+			if _, err := tx.ExecContext(ctx, r.dialect.rebind("INSERT INTO course_translations(course_id, language, name, description) VALUES (?, ?, ?, ?)"),
+				courseID, lang, t.Name, t.Description); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (r *sqlRepo) CreateCourse(ctx context.Context, course entities.Course) (int64, error) {
+	id, err := r.insert(ctx, "INSERT INTO courses(name, track, level, topic, teacher, schedule, description, price, capacity) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		course.Name, course.Track, course.Level, course.Topic, course.Teacher, course.Schedule, course.Description, course.Price, course.Capacity)
+	if err != nil {
+		return 0, fmt.Errorf("create course %q: %w", course.Name, err)
+	}
+	if err := r.saveCourseTranslations(ctx, id, course.Translations); err != nil {
+		return id, fmt.Errorf("save translations of course %d: %w", id, err)
+	}
+	return id, nil
+}
+
+func (r *sqlRepo) UpdateCourse(ctx context.Context, course entities.Course) error {
+	res, err := r.exec(ctx, "UPDATE courses SET name = ?, track = ?, level = ?, topic = ?, teacher = ?, schedule = ?, description = ?, price = ?, capacity = ? WHERE id = ?",
+		course.Name, course.Track, course.Level, course.Topic, course.Teacher, course.Schedule, course.Description, course.Price, course.Capacity, course.ID)
+	if err != nil {
+		return fmt.Errorf("update course %d: %w", course.ID, err)
+	}
+	if err := expectOneRow(res, "course", course.ID); err != nil {
+		return err
+	}
+	if err := r.saveCourseTranslations(ctx, course.ID, course.Translations); err != nil {
+		return fmt.Errorf("save translations of course %d: %w", course.ID, err)
+	}
+	return nil
+}
+
+// ArchiveCourse скрывает курс из списков. Записи на курс сохраняются.
+func (r *sqlRepo) ArchiveCourse(ctx context.Context, id int64) error {
+	res, err := r.exec(ctx, "UPDATE courses SET archived = ? WHERE id = ?", true, id)
+	if err != nil {
+		return fmt.Errorf("archive course %d: %w", id, err)
+	}
+	return expectOneRow(res, "course", id)
+}
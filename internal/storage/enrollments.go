@@ -0,0 +1,198 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"tgbot/internal/entities"
+)
+
+// SaveEnrollment записывает пользователя на курс и возвращает идентификатор
+// записи. Имя и телефон берутся из профиля пользователя в users.
+func (r *sqlRepo) SaveEnrollment(ctx context.Context, userID, courseID int64, isPaid bool, testScore int) (int64, error) {
+	query := `
+	INSERT INTO enrollments(user_id, course_id, course_name, is_paid, test_score, timestamp)
+	VALUES (?, ?, (SELECT name FROM courses WHERE id = ?), ?, ?, ?)`
+	return r.insert(ctx, query, userID, courseID, courseID, isPaid, testScore, time.Now())
+}
+
+// Название курса берётся из courses, а сохранённое в записи используется,
+// только если у старой записи курс не нашёлся при миграции. Так же имя и
+// телефон берутся из профиля, а контакты в самой записи есть только у
+// записей, сделанных до появления users.
+const (
+	enrollmentColumns = `e.id, e.user_id, COALESCE(u.name, e.name, ''), COALESCE(u.phone_number, e.phone_number, ''), COALESCE(e.course_id, 0),
+	COALESCE(c.name, e.course_name), e.is_paid, e.test_score, e.timestamp, COALESCE(e.telegram_charge_id, ''),
+	COALESCE(e.provider_charge_id, ''), e.paid_at, e.canceled_at`
+	enrollmentsFrom = `enrollments e LEFT JOIN courses c ON c.id = e.course_id LEFT JOIN users u ON u.telegram_id = e.user_id`
+)
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanEnrollment(row rowScanner) (entities.Enrollment, error) {
+	var e entities.Enrollment
+	var ts time.Time
+	var paidAt, canceledAt sql.NullTime
+	err := row.Scan(&e.ID, &e.UserID, &e.Name, &e.PhoneNumber, &e.CourseID, &e.CourseName, &e.IsPaid, &e.TestScore, &ts,
+		&e.TelegramChargeID, &e.ProviderChargeID, &paidAt, &canceledAt)
+	if err != nil {
+		return e, err
+	}
+	e.Timestamp = ts.Format("2006-01-02 15:04:05")
+	if paidAt.Valid {
+		e.PaidAt = paidAt.Time.Format("2006-01-02 15:04:05")
+	}
+	e.Canceled = canceledAt.Valid
+	return e, nil
+}
+
+func (r *sqlRepo) GetAllEnrollments(ctx context.Context) ([]entities.Enrollment, error) {
+	query := `SELECT ` + enrollmentColumns + ` FROM ` + enrollmentsFrom + ` ORDER BY e.timestamp DESC`
+	rows, err := r.query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []entities.Enrollment
+	for rows.Next() {
+		e, err := scanEnrollment(rows)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, e)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+func (r *sqlRepo) GetEnrollmentsByUserIDAndCourse(ctx context.Context, userID, courseID int64) ([]entities.Enrollment, error) {
+	rows, err := r.query(ctx, `
+        SELECT `+enrollmentColumns+`
+        FROM `+enrollmentsFrom+`
+        WHERE e.user_id = ? AND e.course_id = ?
+        ORDER BY e.timestamp DESC
+    `, userID, courseID)
+	if err != nil {
+		return nil, fmt.Errorf("query enrollments: %w", err)
+	}
+	defer rows.Close()
+
+	var enrollments []entities.Enrollment
+	for rows.Next() {
+		e, err := scanEnrollment(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan enrollment: %w", err)
+		}
+		enrollments = append(enrollments, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return enrollments, nil
+}
+
+// GetEnrollment возвращает запись по идентификатору или nil, если её нет.
+func (r *sqlRepo) GetEnrollment(ctx context.Context, id int64) (*entities.Enrollment, error) {
+	e, err := scanEnrollment(r.queryRow(ctx, `SELECT `+enrollmentColumns+` FROM `+enrollmentsFrom+` WHERE e.id = ?`, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get enrollment %d: %w", id, err)
+	}
+	return &e, nil
+}
+
+// ErrNotPayable возвращает MarkEnrollmentPaid, если запись уже нельзя
+// оплатить. Конкретную причину уточняют ErrCourseFull и ErrEnrollmentCanceled.
+var ErrNotPayable = errors.New("enrollment is not payable")
+
+var (
+	// ErrCourseFull — на курсе не осталось мест.
+	ErrCourseFull = fmt.Errorf("%w: course is full", ErrNotPayable)
+	// ErrEnrollmentCanceled — запись отменили, пока шла оплата.
+	ErrEnrollmentCanceled = fmt.Errorf("%w: enrollment is canceled", ErrNotPayable)
+)
+
+// MarkEnrollmentPaid отмечает запись оплаченной и сохраняет идентификаторы
+// платежа. Свободные места проверяются тем же запросом, поэтому два платежа
+// не займут последнее место вдвоём: второй получит ErrCourseFull. Место,
+// придержанное для пользователя по листу ожидания, считается его собственным.
+// Отменённая запись не оплачивается: возвращается ErrEnrollmentCanceled.
+func (r *sqlRepo) MarkEnrollmentPaid(ctx context.Context, id int64, telegramChargeID, providerChargeID string, now time.Time) error {
+	return r.inTx(ctx, func(tx *sql.Tx) error {
+		var userID, courseID int64
+		var canceled bool
+		q := `SELECT user_id, course_id, canceled_at IS NOT NULL FROM enrollments WHERE id = ?`
+		if r.dialect == Postgres {
+			// Запись нельзя отменить, пока платёж не проведён
+			q += ` FOR UPDATE`
+		}
+		err := tx.QueryRowContext(ctx, r.dialect.rebind(q), id).Scan(&userID, &courseID, &canceled)
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("enrollment %d not found", id)
+		}
+		if err != nil {
+			return fmt.Errorf("get enrollment %d: %w", id, err)
+		}
+		if canceled {
+			return ErrEnrollmentCanceled
+		}
+		if r.dialect == Postgres {
+			// Платежи за курс проходят по очереди и видят места, занятые друг другом.
+			// В SQLite запись и так выполняется одним писателем.
+			if _, err := tx.ExecContext(ctx, r.dialect.rebind(`SELECT id FROM courses WHERE id = ? FOR UPDATE`), courseID); err != nil {
+				return fmt.Errorf("lock course %d: %w", courseID, err)
+			}
+		}
+
+		res, err := tx.ExecContext(ctx, r.dialect.rebind(`
+		UPDATE enrollments
+		SET is_paid = ?, telegram_charge_id = ?, provider_charge_id = ?, paid_at = ?
+		WHERE id = ? AND canceled_at IS NULL AND (
+			COALESCE((SELECT capacity FROM courses WHERE id = ?), 0) = 0
+			OR (SELECT COUNT(*) FROM enrollments WHERE course_id = ? AND is_paid = ? AND canceled_at IS NULL AND id <> ?)
+				+ (SELECT COUNT(*) FROM waitlist WHERE course_id = ? AND status = ? AND offer_expires_at > ? AND user_id <> ?)
+				< (SELECT capacity FROM courses WHERE id = ?)
+		)`),
+			true, telegramChargeID, providerChargeID, now,
+			id, courseID, courseID, true, id, courseID, entities.WaitlistOffered, now, userID, courseID)
+		if err != nil {
+			return fmt.Errorf("mark enrollment %d paid: %w", id, err)
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			// Отмену проверили выше, значит, не хватило места
+			return ErrCourseFull
+		}
+		return nil
+	})
+}
+
+// CancelEnrollment отменяет запись. Место на курсе освобождается.
+func (r *sqlRepo) CancelEnrollment(ctx context.Context, id int64) error {
+	res, err := r.exec(ctx, `UPDATE enrollments SET canceled_at = ? WHERE id = ? AND canceled_at IS NULL`, time.Now(), id)
+	if err != nil {
+		return fmt.Errorf("cancel enrollment %d: %w", id, err)
+	}
+	return expectOneRow(res, "active enrollment", id)
+}
+
+// CountPaidEnrollments возвращает число занятых мест: оплаченных и не отменённых записей.
+func (r *sqlRepo) CountPaidEnrollments(ctx context.Context, courseID int64) (int, error) {
+	var n int
+	err := r.queryRow(ctx, `SELECT COUNT(*) FROM enrollments WHERE course_id = ? AND is_paid = ? AND canceled_at IS NULL`, courseID, true).Scan(&n)
+	return n, err
+}
@@ -0,0 +1,101 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"tgbot/internal/entities"
+)
+
+// Время задач передаётся снаружи, а не берётся из time.Now: планировщик
+// работает по своим часам, которые в тестах можно перематывать.
+
+func (r *sqlRepo) ScheduleJob(ctx context.Context, job entities.ScheduledJob, now time.Time) (int64, error) {
+	query := `
+	INSERT INTO scheduled_jobs(kind, chat_id, payload, run_at, status, attempts, created_at, updated_at)
+	VALUES (?, ?, ?, ?, ?, 0, ?, ?)`
+	id, err := r.insert(ctx, query, job.Kind, job.ChatID, job.Payload, job.RunAt, entities.JobPending, now, now)
+	if err != nil {
+		return 0, fmt.Errorf("schedule job: %w", err)
+	}
+	return id, nil
+}
+
+// ClaimDueJobs забирает не больше limit задач, время которых наступило:
+// отмечает их выполняемыми до lockedUntil и возвращает в порядке run_at.
+// Выбор и отметка — один UPDATE, поэтому несколько экземпляров бота на одной
+// базе не возьмут одну задачу дважды. Задача, которую взявший её экземпляр
+// не довёл до конца за время блокировки, снова становится доступной.
+func (r *sqlRepo) ClaimDueJobs(ctx context.Context, now, lockedUntil time.Time, limit int) ([]entities.ScheduledJob, error) {
+	// В PostgreSQL строки, уже заблокированные другим экземпляром, пропускаются.
+	// SQLite выполняет запись целиком под блокировкой базы.
+	lock := ""
+	if r.dialect == Postgres {
+		lock = " FOR UPDATE SKIP LOCKED"
+	}
+	rows, err := r.query(ctx, `
+	UPDATE scheduled_jobs SET status = ?, locked_until = ?, updated_at = ?
+	WHERE id IN (
+		SELECT id FROM scheduled_jobs
+		WHERE (status = ? AND run_at <= ?) OR (status = ? AND locked_until <= ?)
+		ORDER BY run_at, id
+		LIMIT ?`+lock+`
+	)
+	RETURNING id, kind, chat_id, COALESCE(payload, ''), run_at, status, attempts`,
+		entities.JobRunning, lockedUntil, now,
+		entities.JobPending, now, entities.JobRunning, now,
+		limit)
+	if err != nil {
+		return nil, fmt.Errorf("claim due jobs: %w", err)
+	}
+	defer rows.Close()
+
+	var jobs []entities.ScheduledJob
+	for rows.Next() {
+		var j entities.ScheduledJob
+		if err := rows.Scan(&j.ID, &j.Kind, &j.ChatID, &j.Payload, &j.RunAt, &j.Status, &j.Attempts); err != nil {
+			return nil, fmt.Errorf("scan job: %w", err)
+		}
+		jobs = append(jobs, j)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	// RETURNING не сохраняет порядок подзапроса
+	sort.Slice(jobs, func(i, j int) bool {
+		if !jobs[i].RunAt.Equal(jobs[j].RunAt) {
+			return jobs[i].RunAt.Before(jobs[j].RunAt)
+		}
+		return jobs[i].ID < jobs[j].ID
+	})
+	return jobs, nil
+}
+
+func (r *sqlRepo) CompleteJob(ctx context.Context, id int64, now time.Time) error {
+	_, err := r.exec(ctx, `UPDATE scheduled_jobs SET status = ?, attempts = attempts + 1, locked_until = NULL, updated_at = ? WHERE id = ?`,
+		entities.JobDone, now, id)
+	return err
+}
+
+// RetryJob возвращает задачу в очередь до runAt после неудачной попытки.
+func (r *sqlRepo) RetryJob(ctx context.Context, id int64, runAt time.Time, lastError string, now time.Time) error {
+	_, err := r.exec(ctx, `UPDATE scheduled_jobs SET status = ?, run_at = ?, attempts = attempts + 1, last_error = ?, locked_until = NULL, updated_at = ? WHERE id = ?`,
+		entities.JobPending, runAt, lastError, now, id)
+	return err
+}
+
+// FailJob прекращает попытки выполнить задачу.
+func (r *sqlRepo) FailJob(ctx context.Context, id int64, lastError string, now time.Time) error {
+	_, err := r.exec(ctx, `UPDATE scheduled_jobs SET status = ?, attempts = attempts + 1, last_error = ?, locked_until = NULL, updated_at = ? WHERE id = ?`,
+		entities.JobFailed, lastError, now, id)
+	return err
+}
+
+// CancelJobs отменяет ожидающие задачи вида kind для чата с данным payload.
+func (r *sqlRepo) CancelJobs(ctx context.Context, chatID int64, kind, payload string, now time.Time) error {
+	_, err := r.exec(ctx, `UPDATE scheduled_jobs SET status = ?, updated_at = ? WHERE chat_id = ? AND kind = ? AND payload = ? AND status = ?`,
+		entities.JobCanceled, now, chatID, kind, payload, entities.JobPending)
+	return err
+}
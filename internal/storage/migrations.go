@@ -0,0 +1,550 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Migration — одно версионированное изменение схемы. Up и Down выполняются
+// в одной транзакции с записью в schema_migrations.
+type Migration struct {
+	Version int
+	Name    string
+	Up      func(ctx context.Context, tx *sql.Tx, d Dialect) error
+	Down    func(ctx context.Context, tx *sql.Tx, d Dialect) error
+}
+
+// MigrationStatus — миграция и время её применения (nil, если не применена).
+type MigrationStatus struct {
+	Migration
+	AppliedAt *time.Time
+}
+
+// Новые миграции добавляются только в конец списка, версии не переиспользуются.
+// Типы, которые различаются в SQLite и PostgreSQL, записываются через
+// подстановки из dialectTypes.
+var migrations = []Migration{
+	{
+		Version: 1,
+		Name:    "initial_schema",
+		Up: execSQL(
+			`CREATE TABLE IF NOT EXISTS courses (
+				id {{pk}},
+				name TEXT,
+				level TEXT,
+				teacher TEXT,
+				schedule TEXT,
+				description TEXT,
+				price {{real}}
+			);`,
+			`CREATE TABLE IF NOT EXISTS conversations (
+				id {{pk}},
+				user_id {{bigint}},
+				role TEXT,
+				message TEXT,
+				timestamp {{timestamp}}
+			);`,
+			`CREATE TABLE IF NOT EXISTS enrollments (
+				id {{pk}},
+				user_id {{bigint}},
+				name TEXT,
+				phone_number TEXT,
+				course_name TEXT,
+				is_paid BOOLEAN,
+				test_score INTEGER,
+				timestamp {{timestamp}}
+			);`,
+			`CREATE TABLE IF NOT EXISTS user_questions (
+				id {{pk}},
+				user_id {{bigint}},
+				question_text TEXT,
+				timestamp {{timestamp}}
+			);`,
+		),
+		// Эти таблицы уже были в рабочей базе до появления миграций, откат
+		// удалил бы все данные.
+		Down: irreversible,
+	},
+	{
+		// Старые базы создавались до появления этих колонок, новые — уже с ними.
+		Version: 2,
+		Name:    "user_questions_contact_columns",
+		Up: func(ctx context.Context, tx *sql.Tx, d Dialect) error {
+			if err := addColumnIfMissing(ctx, tx, d, "user_questions", "name", "TEXT"); err != nil {
+				return err
+			}
+			return addColumnIfMissing(ctx, tx, d, "user_questions", "phone_number", "TEXT")
+		},
+		// В рабочей базе колонки были и до миграции, откат удалил бы контакты
+		// из вопросов.
+		Down: irreversible,
+	},
+	{
+		Version: 3,
+		Name:    "user_states",
+		Up: execSQL(
+			`CREATE TABLE IF NOT EXISTS user_states (
+				user_id {{bigint}} PRIMARY KEY,
+				step TEXT,
+				name TEXT,
+				phone_number TEXT,
+				selected_course TEXT,
+				test_index INTEGER,
+				test_score INTEGER,
+				is_taking_test BOOLEAN,
+				updated_at {{timestamp}}
+			);`,
+		),
+		Down: execSQL(`DROP TABLE IF EXISTS user_states;`),
+	},
+	{
+		Version: 4,
+		Name:    "admins_and_audit_log",
+		Up: execSQL(
+			`CREATE TABLE IF NOT EXISTS admins (
+				user_id {{bigint}} PRIMARY KEY,
+				role TEXT NOT NULL,
+				created_at {{timestamp}}
+			);`,
+			`CREATE TABLE IF NOT EXISTS audit_log (
+				id {{pk}},
+				user_id {{bigint}},
+				command TEXT,
+				allowed BOOLEAN,
+				timestamp {{timestamp}}
+			);`,
+		),
+		Down: execSQL(
+			`DROP TABLE IF EXISTS audit_log;`,
+			`DROP TABLE IF EXISTS admins;`,
+		),
+	},
+	{
+		Version: 5,
+		Name:    "course_tracks",
+		Up: execSQL(
+			`ALTER TABLE courses ADD COLUMN track TEXT;`,
+			`UPDATE courses SET track = 'go' WHERE name LIKE '%Go%';`,
+			`UPDATE courses SET track = 'python' WHERE name LIKE '%Python%' OR name LIKE '%Django%';`,
+			`UPDATE courses SET track = 'cpp' WHERE name LIKE '%C++%';`,
+			`ALTER TABLE user_states ADD COLUMN track TEXT;`,
+		),
+		Down: execSQL(
+			`ALTER TABLE user_states DROP COLUMN track;`,
+			`ALTER TABLE courses DROP COLUMN track;`,
+		),
+	},
+	{
+		// Идентификаторы платежа Telegram и провайдера нужны для сверки с выпиской.
+		Version: 6,
+		Name:    "enrollment_payments",
+		Up: execSQL(
+			`ALTER TABLE enrollments ADD COLUMN telegram_charge_id TEXT;`,
+			`ALTER TABLE enrollments ADD COLUMN provider_charge_id TEXT;`,
+			`ALTER TABLE enrollments ADD COLUMN paid_at {{timestamp}};`,
+		),
+		Down: execSQL(
+			`ALTER TABLE enrollments DROP COLUMN paid_at;`,
+			`ALTER TABLE enrollments DROP COLUMN provider_charge_id;`,
+			`ALTER TABLE enrollments DROP COLUMN telegram_charge_id;`,
+		),
+	},
+	{
+		Version: 7,
+		Name:    "scheduled_jobs",
+		Up: execSQL(
+			`CREATE TABLE IF NOT EXISTS scheduled_jobs (
+				id {{pk}},
+				kind TEXT NOT NULL,
+				chat_id {{bigint}},
+				payload TEXT,
+				run_at {{timestamp}} NOT NULL,
+				status TEXT NOT NULL,
+				attempts INTEGER NOT NULL DEFAULT 0,
+				last_error TEXT,
+				created_at {{timestamp}},
+				updated_at {{timestamp}}
+			);`,
+			`CREATE INDEX IF NOT EXISTS scheduled_jobs_due ON scheduled_jobs(status, run_at);`,
+		),
+		Down: execSQL(
+			`DROP INDEX IF EXISTS scheduled_jobs_due;`,
+			`DROP TABLE IF EXISTS scheduled_jobs;`,
+		),
+	},
+	{
+		// Записи и состояния ссылаются на курс по id, чтобы переименование
+		// курса их не теряло. course_name в enrollments остаётся как название
+		// на момент записи.
+		Version: 8,
+		Name:    "course_foreign_keys",
+		Up: execSQL(
+			`ALTER TABLE enrollments ADD COLUMN course_id {{bigint}} REFERENCES courses(id);`,
+			`UPDATE enrollments SET course_id = (SELECT id FROM courses WHERE courses.name = enrollments.course_name);`,
+			`CREATE INDEX IF NOT EXISTS enrollments_user_course ON enrollments(user_id, course_id);`,
+			`ALTER TABLE user_states ADD COLUMN selected_course_id {{bigint}} REFERENCES courses(id);`,
+			`UPDATE user_states SET selected_course_id = (SELECT id FROM courses WHERE courses.name = user_states.selected_course);`,
+			`UPDATE scheduled_jobs SET payload = (SELECT CAST(id AS TEXT) FROM courses WHERE courses.name = scheduled_jobs.payload)
+				WHERE kind = 'payment_reminder' AND payload IN (SELECT name FROM courses);`,
+		),
+		Down: execSQL(
+			`UPDATE scheduled_jobs SET payload = (SELECT name FROM courses WHERE CAST(courses.id AS TEXT) = scheduled_jobs.payload)
+				WHERE kind = 'payment_reminder' AND payload IN (SELECT CAST(id AS TEXT) FROM courses);`,
+			`UPDATE user_states SET selected_course = (SELECT name FROM courses WHERE courses.id = user_states.selected_course_id)
+				WHERE selected_course_id IS NOT NULL;`,
+			`ALTER TABLE user_states DROP COLUMN selected_course_id;`,
+			`DROP INDEX IF EXISTS enrollments_user_course;`,
+			`ALTER TABLE enrollments DROP COLUMN course_id;`,
+		),
+	},
+	{
+		// Архивные курсы не показываются в списках, но остаются в записях.
+		// course_draft — черновик курса в диалоге администратора, JSON.
+		Version: 9,
+		Name:    "course_admin",
+		Up: execSQL(
+			`ALTER TABLE courses ADD COLUMN archived BOOLEAN NOT NULL DEFAULT FALSE;`,
+			`ALTER TABLE user_states ADD COLUMN course_draft TEXT;`,
+		),
+		Down: execSQL(
+			`ALTER TABLE user_states DROP COLUMN course_draft;`,
+			`ALTER TABLE courses DROP COLUMN archived;`,
+		),
+	},
+	{
+		// capacity = 0 означает, что число мест не ограничено.
+		Version: 10,
+		Name:    "course_capacity_and_waitlist",
+		Up: execSQL(
+			`ALTER TABLE courses ADD COLUMN capacity INTEGER NOT NULL DEFAULT 0;`,
+			`ALTER TABLE enrollments ADD COLUMN canceled_at {{timestamp}};`,
+			`CREATE TABLE IF NOT EXISTS waitlist (
+				id {{pk}},
+				user_id {{bigint}} NOT NULL,
+				course_id {{bigint}} NOT NULL REFERENCES courses(id),
+				status TEXT NOT NULL,
+				created_at {{timestamp}},
+				offer_expires_at {{timestamp}},
+				updated_at {{timestamp}}
+			);`,
+			`CREATE INDEX IF NOT EXISTS waitlist_course_status ON waitlist(course_id, status);`,
+		),
+		Down: execSQL(
+			`DROP INDEX IF EXISTS waitlist_course_status;`,
+			`DROP TABLE IF EXISTS waitlist;`,
+			`ALTER TABLE enrollments DROP COLUMN canceled_at;`,
+			`ALTER TABLE courses DROP COLUMN capacity;`,
+		),
+	},
+	{
+		// Существующие вопросы остаются открытыми: на них ещё никто не ответил.
+		Version: 11,
+		Name:    "user_question_status",
+		Up: execSQL(
+			`ALTER TABLE user_questions ADD COLUMN status TEXT NOT NULL DEFAULT 'open';`,
+			`ALTER TABLE user_questions ADD COLUMN answer_text TEXT;`,
+			`ALTER TABLE user_questions ADD COLUMN answered_by {{bigint}};`,
+			`ALTER TABLE user_questions ADD COLUMN answered_at {{timestamp}};`,
+			`CREATE INDEX IF NOT EXISTS user_questions_status ON user_questions(status);`,
+		),
+		Down: execSQL(
+			`DROP INDEX IF EXISTS user_questions_status;`,
+			`ALTER TABLE user_questions DROP COLUMN answered_at;`,
+			`ALTER TABLE user_questions DROP COLUMN answered_by;`,
+			`ALTER TABLE user_questions DROP COLUMN answer_text;`,
+			`ALTER TABLE user_questions DROP COLUMN status;`,
+		),
+	},
+	{
+		Version: 12,
+		Name:    "support_messages",
+		Up: execSQL(
+			`CREATE TABLE IF NOT EXISTS support_messages (
+				chat_id {{bigint}} NOT NULL,
+				message_id {{bigint}} NOT NULL,
+				user_id {{bigint}} NOT NULL,
+				created_at {{timestamp}},
+				PRIMARY KEY (chat_id, message_id)
+			);`,
+		),
+		Down: execSQL(
+			`DROP TABLE IF EXISTS support_messages;`,
+		),
+	},
+	{
+		// language — язык интерфейса пользователя. Основные название и
+		// описание курса остаются в courses, переводы — в course_translations.
+		Version: 13,
+		Name:    "i18n",
+		Up: execSQL(
+			`ALTER TABLE user_states ADD COLUMN language TEXT;`,
+			`CREATE TABLE IF NOT EXISTS course_translations (
+				course_id {{bigint}} NOT NULL REFERENCES courses(id),
+				language TEXT NOT NULL,
+				name TEXT NOT NULL DEFAULT '',
+				description TEXT NOT NULL DEFAULT '',
+				PRIMARY KEY (course_id, language)
+			);`,
+		),
+		Down: execSQL(
+			`DROP TABLE IF EXISTS course_translations;`,
+			`ALTER TABLE user_states DROP COLUMN language;`,
+		),
+	},
+	{
+		// Имя и телефон теперь хранятся в профиле пользователя, а не в каждой
+		// записи на курс. Профиль берётся из последней записи, а если записей
+		// нет — из состояния диалога.
+		Version: 14,
+		Name:    "users",
+		Up: execSQL(
+			`CREATE TABLE IF NOT EXISTS users (
+				telegram_id {{bigint}} PRIMARY KEY,
+				name TEXT NOT NULL DEFAULT '',
+				phone_number TEXT NOT NULL DEFAULT '',
+				language TEXT NOT NULL DEFAULT '',
+				created_at {{timestamp}},
+				last_seen_at {{timestamp}}
+			);`,
+			`INSERT INTO users(telegram_id, name, phone_number, language, created_at, last_seen_at)
+				SELECT e.user_id, COALESCE(e.name, ''), COALESCE(e.phone_number, ''),
+					COALESCE((SELECT s.language FROM user_states s WHERE s.user_id = e.user_id), ''),
+					(SELECT MIN(f.timestamp) FROM enrollments f WHERE f.user_id = e.user_id), e.timestamp
+				FROM enrollments e
+				WHERE e.id = (SELECT MAX(f.id) FROM enrollments f WHERE f.user_id = e.user_id);`,
+			`INSERT INTO users(telegram_id, name, phone_number, language, created_at, last_seen_at)
+				SELECT s.user_id, s.name, COALESCE(s.phone_number, ''), COALESCE(s.language, ''), s.updated_at, s.updated_at
+				FROM user_states s
+				WHERE COALESCE(s.name, '') <> '' AND s.user_id NOT IN (SELECT telegram_id FROM users);`,
+		),
+		// enrollments.name и phone_number не удаляются: новые записи их не
+		// заполняют, но у старых записей это единственная копия контактов.
+		Down: execSQL(
+			`DROP TABLE IF EXISTS users;`,
+		),
+	},
+	{
+		Version: 15,
+		Name:    "adaptive_test",
+		Up: execSQL(
+			`ALTER TABLE user_states ADD COLUMN test_seed {{bigint}};`,
+			`ALTER TABLE user_states ADD COLUMN test_answers TEXT;`,
+			`ALTER TABLE courses ADD COLUMN topic TEXT;`,
+			`UPDATE courses SET topic = 'basics' WHERE name IN ('Go для начинающих', 'Python для начинающих', 'Основы программирования на C++');`,
+			`UPDATE courses SET topic = 'concurrency' WHERE name = 'Go для продвинутых';`,
+			`UPDATE courses SET topic = 'services' WHERE name = 'Архитектура микросервисов на Go';`,
+			`UPDATE courses SET topic = 'web' WHERE name = 'Разработка веб-приложений на Django';`,
+		),
+		Down: execSQL(
+			`ALTER TABLE courses DROP COLUMN topic;`,
+			`ALTER TABLE user_states DROP COLUMN test_answers;`,
+			`ALTER TABLE user_states DROP COLUMN test_seed;`,
+		),
+	},
+	{
+		Version: 16,
+		Name:    "test_attempts",
+		Up: execSQL(
+			`CREATE TABLE IF NOT EXISTS test_attempts (
+				id {{pk}},
+				user_id {{bigint}} NOT NULL,
+				track TEXT NOT NULL,
+				seed {{bigint}} NOT NULL DEFAULT 0,
+				score INTEGER NOT NULL DEFAULT 0,
+				total INTEGER NOT NULL DEFAULT 0,
+				level TEXT NOT NULL DEFAULT '',
+				topic_levels TEXT,
+				started_at {{timestamp}},
+				finished_at {{timestamp}}
+			);`,
+			`CREATE INDEX IF NOT EXISTS test_attempts_user ON test_attempts(user_id);`,
+			`CREATE TABLE IF NOT EXISTS test_answers (
+				attempt_id {{bigint}} NOT NULL REFERENCES test_attempts(id),
+				position INTEGER NOT NULL,
+				question_index INTEGER NOT NULL,
+				question TEXT NOT NULL,
+				topic TEXT NOT NULL DEFAULT '',
+				level TEXT NOT NULL DEFAULT '',
+				answer_index INTEGER,
+				answer_text TEXT,
+				correct BOOLEAN,
+				shown_at {{timestamp}},
+				answered_at {{timestamp}},
+				PRIMARY KEY (attempt_id, position)
+			);`,
+			`ALTER TABLE user_states ADD COLUMN test_attempt_id {{bigint}};`,
+		),
+		Down: execSQL(
+			`ALTER TABLE user_states DROP COLUMN test_attempt_id;`,
+			`DROP TABLE IF EXISTS test_answers;`,
+			`DROP INDEX IF EXISTS test_attempts_user;`,
+			`DROP TABLE IF EXISTS test_attempts;`,
+		),
+	},
+	{
+		Version: 17,
+		Name:    "job_claims",
+		Up: execSQL(
+			`ALTER TABLE scheduled_jobs ADD COLUMN locked_until {{timestamp}};`,
+		),
+		Down: execSQL(
+			`UPDATE scheduled_jobs SET status = 'pending' WHERE status = 'running';`,
+			`ALTER TABLE scheduled_jobs DROP COLUMN locked_until;`,
+		),
+	},
+}
+
+// irreversible — Down миграции, которую нельзя откатить без потери данных.
+func irreversible(ctx context.Context, tx *sql.Tx, d Dialect) error {
+	return errors.New("migration is irreversible")
+}
+
+func execSQL(statements ...string) func(ctx context.Context, tx *sql.Tx, d Dialect) error {
+	return func(ctx context.Context, tx *sql.Tx, d Dialect) error {
+		for _, stmt := range statements {
+			if _, err := tx.ExecContext(ctx, d.expand(stmt)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+func addColumnIfMissing(ctx context.Context, tx *sql.Tx, d Dialect, table, column, definition string) error {
+	exists, err := columnExists(ctx, tx, d, table, column)
+	if err != nil || exists {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, d.expand(definition)))
+	return err
+}
+
+func columnExists(ctx context.Context, tx *sql.Tx, d Dialect, table, column string) (bool, error) {
+	if d == Postgres {
+		return postgresColumnExists(ctx, tx, table, column)
+	}
+	return sqliteColumnExists(ctx, tx, table, column)
+}
+
+func (r *sqlRepo) ensureMigrationsTable(ctx context.Context) error {
+	_, err := r.exec(ctx, r.dialect.expand(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		name TEXT,
+		applied_at {{timestamp}}
+	);`))
+	return err
+}
+
+func (r *sqlRepo) appliedMigrations(ctx context.Context) (map[int]time.Time, error) {
+	if err := r.ensureMigrationsTable(ctx); err != nil {
+		return nil, fmt.Errorf("create schema_migrations: %w", err)
+	}
+
+	rows, err := r.query(ctx, `SELECT version, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, fmt.Errorf("query schema_migrations: %w", err)
+	}
+	defer rows.Close()
+
+	applied := make(map[int]time.Time)
+	for rows.Next() {
+		var version int
+		var appliedAt time.Time
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, fmt.Errorf("scan schema_migrations: %w", err)
+		}
+		applied[version] = appliedAt
+	}
+	return applied, rows.Err()
+}
+
+// MigrateUp применяет все ещё не применённые миграции по порядку.
+func (s *Store) MigrateUp(ctx context.Context) ([]Migration, error) {
+	r := s.repo
+	applied, err := r.appliedMigrations(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var done []Migration
+	for _, m := range migrations {
+		if _, ok := applied[m.Version]; ok {
+			continue
+		}
+		err := r.inTx(ctx, func(tx *sql.Tx) error {
+			if err := m.Up(ctx, tx, r.dialect); err != nil {
+				return err
+			}
+			_, err := tx.ExecContext(ctx, r.dialect.rebind(`INSERT INTO schema_migrations(version, name, applied_at) VALUES (?, ?, ?)`), m.Version, m.Name, time.Now())
+			return err
+		})
+		if err != nil {
+			return done, fmt.Errorf("migration %d_%s up: %w", m.Version, m.Name, err)
+		}
+		done = append(done, m)
+	}
+	return done, nil
+}
+
+// MigrateDown откатывает последние steps применённых миграций.
+func (s *Store) MigrateDown(ctx context.Context, steps int) ([]Migration, error) {
+	r := s.repo
+	applied, err := r.appliedMigrations(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var done []Migration
+	for i := len(migrations) - 1; i >= 0 && len(done) < steps; i-- {
+		m := migrations[i]
+		if _, ok := applied[m.Version]; !ok {
+			continue
+		}
+		err := r.inTx(ctx, func(tx *sql.Tx) error {
+			if err := m.Down(ctx, tx, r.dialect); err != nil {
+				return err
+			}
+			_, err := tx.ExecContext(ctx, r.dialect.rebind(`DELETE FROM schema_migrations WHERE version = ?`), m.Version)
+			return err
+		})
+		if err != nil {
+			return done, fmt.Errorf("migration %d_%s down: %w", m.Version, m.Name, err)
+		}
+		done = append(done, m)
+	}
+	return done, nil
+}
+
+// MigrationStatus возвращает все известные миграции с отметкой о применении.
+func (s *Store) MigrationStatus(ctx context.Context) ([]MigrationStatus, error) {
+	applied, err := s.repo.appliedMigrations(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]MigrationStatus, 0, len(migrations))
+	for _, m := range migrations {
+		status := MigrationStatus{Migration: m}
+		if at, ok := applied[m.Version]; ok {
+			status.AppliedAt = &at
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// inTx выполняет fn в транзакции. При отмене ctx транзакция откатывается.
+func (r *sqlRepo) inTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
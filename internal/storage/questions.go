@@ -0,0 +1,101 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"tgbot/internal/entities"
+)
+
+const questionColumns = `id, user_id, name, phone_number, question_text, timestamp, status, answer_text, answered_at`
+
+func scanUserQuestion(row rowScanner) (entities.UserQuestion, error) {
+	var q entities.UserQuestion
+	var ts time.Time
+	var name, phone, answer sql.NullString
+	var answeredAt sql.NullTime
+	if err := row.Scan(&q.ID, &q.UserID, &name, &phone, &q.QuestionText, &ts, &q.Status, &answer, &answeredAt); err != nil {
+		return q, err
+	}
+	q.Name = name.String
+	q.PhoneNumber = phone.String
+	q.Answer = answer.String
+	q.Timestamp = ts.Format("2006-01-02 15:04:05")
+	if answeredAt.Valid {
+		q.AnsweredAt = answeredAt.Time.Format("2006-01-02 15:04:05")
+	}
+	return q, nil
+}
+
+// SaveUserQuestion сохраняет открытый вопрос и возвращает его id.
+func (r *sqlRepo) SaveUserQuestion(ctx context.Context, userID int64, name string, phoneNumber string, questionText string) (int64, error) {
+	query := `
+	INSERT INTO user_questions(user_id, name, phone_number, question_text, timestamp, status)
+	VALUES (?, ?, ?, ?, ?, ?)`
+	id, err := r.insert(ctx, query, userID, name, phoneNumber, questionText, time.Now(), entities.QuestionOpen)
+	if err != nil {
+		return 0, fmt.Errorf("save user question: %w", err)
+	}
+	return id, nil
+}
+
+// GetUserQuestions возвращает вопросы со статусом status, пустой status — все вопросы.
+func (r *sqlRepo) GetUserQuestions(ctx context.Context, status string) ([]entities.UserQuestion, error) {
+	query := `SELECT ` + questionColumns + ` FROM user_questions`
+	var args []interface{}
+	if status != "" {
+		query += ` WHERE status = ?`
+		args = append(args, status)
+	}
+	rows, err := r.query(ctx, query+` ORDER BY timestamp DESC`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var questions []entities.UserQuestion
+	for rows.Next() {
+		q, err := scanUserQuestion(rows)
+		if err != nil {
+			return nil, err
+		}
+		questions = append(questions, q)
+	}
+	return questions, rows.Err()
+}
+
+// GetUserQuestion возвращает вопрос по id или nil, если его нет.
+func (r *sqlRepo) GetUserQuestion(ctx context.Context, id int64) (*entities.UserQuestion, error) {
+	q, err := scanUserQuestion(r.queryRow(ctx, `SELECT `+questionColumns+` FROM user_questions WHERE id = ?`, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("query user question %d: %w", id, err)
+	}
+	return &q, nil
+}
+
+// AnswerUserQuestion сохраняет ответ сотрудника. Повторный ответ на уже
+// отвеченный вопрос заменяет прежний, закрытые вопросы не меняются.
+func (r *sqlRepo) AnswerUserQuestion(ctx context.Context, id int64, answer string, answeredBy int64) error {
+	res, err := r.exec(ctx, `UPDATE user_questions SET status = ?, answer_text = ?, answered_by = ?, answered_at = ?
+		WHERE id = ? AND status <> ?`,
+		entities.QuestionAnswered, answer, answeredBy, time.Now(), id, entities.QuestionClosed)
+	if err != nil {
+		return fmt.Errorf("answer user question %d: %w", id, err)
+	}
+	return expectOneRow(res, "unclosed user question", id)
+}
+
+// CloseUserQuestion закрывает вопрос без ответа или после него.
+func (r *sqlRepo) CloseUserQuestion(ctx context.Context, id int64) error {
+	res, err := r.exec(ctx, `UPDATE user_questions SET status = ? WHERE id = ? AND status <> ?`,
+		entities.QuestionClosed, id, entities.QuestionClosed)
+	if err != nil {
+		return fmt.Errorf("close user question %d: %w", id, err)
+	}
+	return expectOneRow(res, "unclosed user question", id)
+}
@@ -0,0 +1,279 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"tgbot/internal/entities"
+)
+
+// DefaultDSN — база SQLite, с которой бот работал до появления DATABASE_URL.
+const DefaultDSN = "./internal/storage/courses.db"
+
+type CourseRepository interface {
+	GetCourses(ctx context.Context) ([]entities.Course, error)
+	SeedCourses(ctx context.Context) error
+	CreateCourse(ctx context.Context, course entities.Course) (int64, error)
+	UpdateCourse(ctx context.Context, course entities.Course) error
+	ArchiveCourse(ctx context.Context, id int64) error
+}
+
+type UserRepository interface {
+	GetUser(ctx context.Context, telegramID int64) (*entities.User, error)
+	SaveUser(ctx context.Context, user entities.User) error
+	TouchUser(ctx context.Context, telegramID int64, now time.Time) error
+	FindUserByPhone(ctx context.Context, phoneNumber string) (*entities.User, error)
+}
+
+type EnrollmentRepository interface {
+	SaveEnrollment(ctx context.Context, userID, courseID int64, isPaid bool, testScore int) (int64, error)
+	GetAllEnrollments(ctx context.Context) ([]entities.Enrollment, error)
+	GetEnrollmentsByUserIDAndCourse(ctx context.Context, userID, courseID int64) ([]entities.Enrollment, error)
+	GetEnrollment(ctx context.Context, id int64) (*entities.Enrollment, error)
+	MarkEnrollmentPaid(ctx context.Context, id int64, telegramChargeID, providerChargeID string, now time.Time) error
+	CancelEnrollment(ctx context.Context, id int64) error
+	CountPaidEnrollments(ctx context.Context, courseID int64) (int, error)
+}
+
+type WaitlistRepository interface {
+	AddToWaitlist(ctx context.Context, userID, courseID int64, now time.Time) (*entities.WaitlistEntry, error)
+	GetWaitlistEntry(ctx context.Context, id int64) (*entities.WaitlistEntry, error)
+	GetUserWaitlist(ctx context.Context, userID int64, now time.Time) ([]entities.WaitlistEntry, error)
+	NextWaiting(ctx context.Context, courseID int64) (*entities.WaitlistEntry, error)
+	ActiveOffer(ctx context.Context, userID, courseID int64, now time.Time) (*entities.WaitlistEntry, error)
+	CountActiveOffers(ctx context.Context, courseID int64, now time.Time) (int, error)
+	OfferSeat(ctx context.Context, id int64, expiresAt, now time.Time) error
+	SetWaitlistStatus(ctx context.Context, id int64, status string, now time.Time) error
+}
+
+type ConversationRepository interface {
+	SaveMessage(ctx context.Context, userID int64, role, message string) error
+	GetConversationHistory(ctx context.Context, userID int64) ([]entities.Message, error)
+}
+
+type QuestionRepository interface {
+	SaveUserQuestion(ctx context.Context, userID int64, name, phoneNumber, questionText string) (int64, error)
+	GetUserQuestions(ctx context.Context, status string) ([]entities.UserQuestion, error)
+	GetUserQuestion(ctx context.Context, id int64) (*entities.UserQuestion, error)
+	AnswerUserQuestion(ctx context.Context, id int64, answer string, answeredBy int64) error
+	CloseUserQuestion(ctx context.Context, id int64) error
+}
+
+type UserStateRepository interface {
+	GetUserState(ctx context.Context, userID int64) (*entities.UserState, error)
+	SaveUserState(ctx context.Context, userID int64, state *entities.UserState) error
+}
+
+type AdminRepository interface {
+	GetAdminRole(ctx context.Context, userID int64) (entities.Role, error)
+	ListAdmins(ctx context.Context) (map[int64]entities.Role, error)
+	SaveAdmin(ctx context.Context, userID int64, role entities.Role) error
+	ReplaceAdmins(ctx context.Context, admins map[int64]entities.Role) error
+	SaveAuditEntry(ctx context.Context, userID int64, command string, allowed bool) error
+}
+
+type JobRepository interface {
+	ScheduleJob(ctx context.Context, job entities.ScheduledJob, now time.Time) (int64, error)
+	ClaimDueJobs(ctx context.Context, now, lockedUntil time.Time, limit int) ([]entities.ScheduledJob, error)
+	CompleteJob(ctx context.Context, id int64, now time.Time) error
+	RetryJob(ctx context.Context, id int64, runAt time.Time, lastError string, now time.Time) error
+	FailJob(ctx context.Context, id int64, lastError string, now time.Time) error
+	CancelJobs(ctx context.Context, chatID int64, kind, payload string, now time.Time) error
+}
+
+type TestRepository interface {
+	StartTestAttempt(ctx context.Context, userID int64, track string, seed int64, now time.Time) (int64, error)
+	SaveTestQuestion(ctx context.Context, attemptID int64, answer entities.TestAttemptAnswer) error
+	SaveTestAnswer(ctx context.Context, attemptID int64, position, answer int, answerText string, correct bool, now time.Time) error
+	FinishTestAttempt(ctx context.Context, attempt entities.TestAttempt) error
+	GetTestAttempts(ctx context.Context, userID int64) ([]entities.TestAttempt, error)
+	RecentTestAttempts(ctx context.Context, limit int) ([]entities.TestAttempt, error)
+}
+
+type SupportRepository interface {
+	SaveSupportMessage(ctx context.Context, chatID int64, messageID int, userID int64) error
+	SupportMessageUser(ctx context.Context, chatID int64, messageID int) (int64, error)
+}
+
+// Store объединяет репозитории поверх одного подключения к базе.
+type Store struct {
+	Courses       CourseRepository
+	Users         UserRepository
+	Enrollments   EnrollmentRepository
+	Conversations ConversationRepository
+	Questions     QuestionRepository
+	UserStates    UserStateRepository
+	Admins        AdminRepository
+	Jobs          JobRepository
+	Waitlist      WaitlistRepository
+	Support       SupportRepository
+	Tests         TestRepository
+
+	repo *sqlRepo
+}
+
+// Open подключается к базе по DSN без применения миграций.
+// DSN вида postgres://... выбирает PostgreSQL, всё остальное считается
+// путём к файлу SQLite. Пустой DSN означает DefaultDSN.
+func Open(dsn string) (*Store, error) {
+	var (
+		db      *sql.DB
+		dialect Dialect
+		err     error
+	)
+	switch {
+	case strings.HasPrefix(dsn, "postgres://"), strings.HasPrefix(dsn, "postgresql://"):
+		dialect = Postgres
+		db, err = openPostgres(dsn)
+	default:
+		dialect = SQLite
+		db, err = openSQLite(strings.TrimPrefix(dsn, "sqlite://"))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("open %s: %w", dialect, err)
+	}
+
+	repo := &sqlRepo{db: db, dialect: dialect}
+	return &Store{
+		Courses:       repo,
+		Users:         repo,
+		Enrollments:   repo,
+		Conversations: repo,
+		Questions:     repo,
+		UserStates:    repo,
+		Admins:        repo,
+		Jobs:          repo,
+		Waitlist:      repo,
+		Support:       repo,
+		Tests:         repo,
+		repo:          repo,
+	}, nil
+}
+
+// InitDB подключается к базе и применяет недостающие миграции.
+func InitDB(ctx context.Context, dsn string) (*Store, error) {
+	store, err := Open(dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := store.MigrateUp(ctx); err != nil {
+		store.Close()
+		return nil, err
+	}
+
+	return store, nil
+}
+
+func (s *Store) Close() error {
+	return s.repo.db.Close()
+}
+
+func (s *Store) Dialect() Dialect {
+	return s.repo.dialect
+}
+
+// Dialect — диалект SQL конкретной базы.
+type Dialect int
+
+const (
+	SQLite Dialect = iota
+	Postgres
+)
+
+func (d Dialect) String() string {
+	if d == Postgres {
+		return "postgres"
+	}
+	return "sqlite"
+}
+
+// rebind заменяет плейсхолдеры ? на $1, $2, ... для PostgreSQL.
+func (d Dialect) rebind(query string) string {
+	if d != Postgres {
+		return query
+	}
+
+	var sb strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			sb.WriteByte('$')
+			sb.WriteString(strconv.Itoa(n))
+			continue
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
+
+// Типы колонок, которые различаются между диалектами. В DDL миграций
+// используются как {{pk}}, {{bigint}}, {{real}} и {{timestamp}}.
+var dialectTypes = map[Dialect]*strings.Replacer{
+	SQLite: strings.NewReplacer(
+		"{{pk}}", "INTEGER PRIMARY KEY AUTOINCREMENT",
+		"{{bigint}}", "INTEGER",
+		"{{real}}", "REAL",
+		"{{timestamp}}", "DATETIME",
+	),
+	Postgres: strings.NewReplacer(
+		"{{pk}}", "BIGSERIAL PRIMARY KEY",
+		"{{bigint}}", "BIGINT",
+		"{{real}}", "DOUBLE PRECISION",
+		"{{timestamp}}", "TIMESTAMPTZ",
+	),
+}
+
+func (d Dialect) expand(ddl string) string {
+	return dialectTypes[d].Replace(ddl)
+}
+
+// sqlRepo реализует все репозитории поверх database/sql. Запросы пишутся
+// с плейсхолдерами ? и переводятся в диалект базы при выполнении.
+type sqlRepo struct {
+	db      *sql.DB
+	dialect Dialect
+}
+
+func (r *sqlRepo) exec(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return r.db.ExecContext(ctx, r.dialect.rebind(query), args...)
+}
+
+func (r *sqlRepo) query(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return r.db.QueryContext(ctx, r.dialect.rebind(query), args...)
+}
+
+func (r *sqlRepo) queryRow(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	return r.db.QueryRowContext(ctx, r.dialect.rebind(query), args...)
+}
+
+// insert выполняет INSERT и возвращает id новой строки. PostgreSQL не
+// поддерживает LastInsertId, поэтому для него id читается через RETURNING.
+func (r *sqlRepo) insert(ctx context.Context, query string, args ...interface{}) (int64, error) {
+	if r.dialect == Postgres {
+		var id int64
+		err := r.queryRow(ctx, query+" RETURNING id", args...).Scan(&id)
+		return id, err
+	}
+	res, err := r.exec(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+func expectOneRow(res sql.Result, what string, id int64) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("%s %d not found", what, id)
+	}
+	return nil
+}
@@ -0,0 +1,35 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// SaveSupportMessage запоминает, от какого пользователя пришло сообщение
+// messageID в чате поддержки, чтобы ответ сотрудника вернулся к нему.
+func (r *sqlRepo) SaveSupportMessage(ctx context.Context, chatID int64, messageID int, userID int64) error {
+	query := `
+	INSERT INTO support_messages(chat_id, message_id, user_id, created_at)
+	VALUES (?, ?, ?, ?)
+	ON CONFLICT(chat_id, message_id) DO UPDATE SET user_id = excluded.user_id;`
+	if _, err := r.exec(ctx, query, chatID, messageID, userID, time.Now()); err != nil {
+		return fmt.Errorf("save support message: %w", err)
+	}
+	return nil
+}
+
+// SupportMessageUser возвращает пользователя, к которому относится сообщение
+// в чате поддержки, или 0, если сообщение не пересылалось ботом.
+func (r *sqlRepo) SupportMessageUser(ctx context.Context, chatID int64, messageID int) (int64, error) {
+	var userID int64
+	err := r.queryRow(ctx, `SELECT user_id FROM support_messages WHERE chat_id = ? AND message_id = ?`, chatID, messageID).Scan(&userID)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("query support message: %w", err)
+	}
+	return userID, nil
+}
@@ -0,0 +1,160 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"tgbot/internal/entities"
+)
+
+// Имя и телефон берутся из профиля, Enrolled — есть ли у пользователя
+// хоть одна запись на курс.
+const testAttemptColumns = `a.id, a.user_id, COALESCE(u.name, ''), COALESCE(u.phone_number, ''), a.track,
+	a.score, a.total, a.level, a.topic_levels, a.started_at, a.finished_at,
+	EXISTS (SELECT 1 FROM enrollments e WHERE e.user_id = a.user_id)`
+
+const testAttemptFrom = `test_attempts a LEFT JOIN users u ON u.telegram_id = a.user_id`
+
+func scanTestAttempt(row rowScanner) (entities.TestAttempt, error) {
+	var a entities.TestAttempt
+	var topicLevels sql.NullString
+	var startedAt, finishedAt sql.NullTime
+	err := row.Scan(&a.ID, &a.UserID, &a.Name, &a.PhoneNumber, &a.Track,
+		&a.Score, &a.Total, &a.Level, &topicLevels, &startedAt, &finishedAt, &a.Enrolled)
+	if err != nil {
+		return a, err
+	}
+	a.StartedAt = startedAt.Time
+	a.FinishedAt = finishedAt.Time
+	if topicLevels.Valid && topicLevels.String != "" {
+		if err := json.Unmarshal([]byte(topicLevels.String), &a.TopicLevels); err != nil {
+			return a, fmt.Errorf("decode topic levels: %w", err)
+		}
+	}
+	return a, nil
+}
+
+func (r *sqlRepo) StartTestAttempt(ctx context.Context, userID int64, track string, seed int64, now time.Time) (int64, error) {
+	id, err := r.insert(ctx, `INSERT INTO test_attempts(user_id, track, seed, started_at) VALUES (?, ?, ?, ?)`,
+		userID, track, seed, now)
+	if err != nil {
+		return 0, fmt.Errorf("start test attempt: %w", err)
+	}
+	return id, nil
+}
+
+// SaveTestQuestion записывает показанный вопрос. Повторный показ того же
+// вопроса, например после неверного ввода, время показа не меняет.
+func (r *sqlRepo) SaveTestQuestion(ctx context.Context, attemptID int64, a entities.TestAttemptAnswer) error {
+	_, err := r.exec(ctx, `
+	INSERT INTO test_answers(attempt_id, position, question_index, question, topic, level, shown_at)
+	VALUES (?, ?, ?, ?, ?, ?, ?)
+	ON CONFLICT(attempt_id, position) DO NOTHING`,
+		attemptID, a.Position, a.Question, a.Text, a.Topic, a.Level, a.ShownAt)
+	if err != nil {
+		return fmt.Errorf("save test question: %w", err)
+	}
+	return nil
+}
+
+func (r *sqlRepo) SaveTestAnswer(ctx context.Context, attemptID int64, position, answer int, answerText string, correct bool, now time.Time) error {
+	_, err := r.exec(ctx, `UPDATE test_answers SET answer_index = ?, answer_text = ?, correct = ?, answered_at = ?
+		WHERE attempt_id = ? AND position = ?`, answer, answerText, correct, now, attemptID, position)
+	if err != nil {
+		return fmt.Errorf("save test answer: %w", err)
+	}
+	return nil
+}
+
+// FinishTestAttempt сохраняет результат попытки attempt.ID.
+func (r *sqlRepo) FinishTestAttempt(ctx context.Context, attempt entities.TestAttempt) error {
+	var topicLevels sql.NullString
+	if len(attempt.TopicLevels) > 0 {
+		data, err := json.Marshal(attempt.TopicLevels)
+		if err != nil {
+			return fmt.Errorf("encode topic levels: %w", err)
+		}
+		topicLevels = sql.NullString{String: string(data), Valid: true}
+	}
+
+	_, err := r.exec(ctx, `UPDATE test_attempts SET score = ?, total = ?, level = ?, topic_levels = ?, finished_at = ? WHERE id = ?`,
+		attempt.Score, attempt.Total, attempt.Level, topicLevels, attempt.FinishedAt, attempt.ID)
+	if err != nil {
+		return fmt.Errorf("finish test attempt %d: %w", attempt.ID, err)
+	}
+	return nil
+}
+
+// GetTestAttempts возвращает попытки пользователя с ответами, новые первыми.
+func (r *sqlRepo) GetTestAttempts(ctx context.Context, userID int64) ([]entities.TestAttempt, error) {
+	attempts, err := r.listTestAttempts(ctx, `WHERE a.user_id = ? ORDER BY a.id DESC`, userID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range attempts {
+		answers, err := r.testAnswers(ctx, attempts[i].ID)
+		if err != nil {
+			return nil, err
+		}
+		attempts[i].Answers = answers
+	}
+	return attempts, nil
+}
+
+// RecentTestAttempts возвращает последние limit попыток всех пользователей без ответов.
+func (r *sqlRepo) RecentTestAttempts(ctx context.Context, limit int) ([]entities.TestAttempt, error) {
+	return r.listTestAttempts(ctx, `ORDER BY a.id DESC LIMIT ?`, limit)
+}
+
+func (r *sqlRepo) listTestAttempts(ctx context.Context, where string, args ...interface{}) ([]entities.TestAttempt, error) {
+	rows, err := r.query(ctx, `SELECT `+testAttemptColumns+` FROM `+testAttemptFrom+` `+where, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query test attempts: %w", err)
+	}
+	defer rows.Close()
+
+	var attempts []entities.TestAttempt
+	for rows.Next() {
+		a, err := scanTestAttempt(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan test attempt: %w", err)
+		}
+		attempts = append(attempts, a)
+	}
+	return attempts, rows.Err()
+}
+
+func (r *sqlRepo) testAnswers(ctx context.Context, attemptID int64) ([]entities.TestAttemptAnswer, error) {
+	rows, err := r.query(ctx, `
+	SELECT position, question_index, question, topic, level, answer_index, answer_text, correct, shown_at, answered_at
+	FROM test_answers WHERE attempt_id = ? ORDER BY position`, attemptID)
+	if err != nil {
+		return nil, fmt.Errorf("query test answers: %w", err)
+	}
+	defer rows.Close()
+
+	var answers []entities.TestAttemptAnswer
+	for rows.Next() {
+		var a entities.TestAttemptAnswer
+		var answer sql.NullInt64
+		var answerText sql.NullString
+		var correct sql.NullBool
+		var shownAt, answeredAt sql.NullTime
+		if err := rows.Scan(&a.Position, &a.Question, &a.Text, &a.Topic, &a.Level, &answer, &answerText, &correct, &shownAt, &answeredAt); err != nil {
+			return nil, fmt.Errorf("scan test answer: %w", err)
+		}
+		a.Answer = -1
+		if answer.Valid {
+			a.Answer = int(answer.Int64)
+		}
+		a.AnswerText = answerText.String
+		a.Correct = correct.Bool
+		a.ShownAt = shownAt.Time
+		a.AnsweredAt = answeredAt.Time
+		answers = append(answers, a)
+	}
+	return answers, rows.Err()
+}
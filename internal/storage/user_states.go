@@ -0,0 +1,121 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"tgbot/internal/entities"
+)
+
+// GetUserState возвращает сохранённое состояние диалога пользователя.
+// Если состояния ещё нет, возвращается пустое состояние.
+func (r *sqlRepo) GetUserState(ctx context.Context, userID int64) (*entities.UserState, error) {
+	query := `
+	SELECT s.step, s.name, s.phone_number, COALESCE(s.track, ''), s.test_index, s.test_score, s.is_taking_test, COALESCE(s.test_seed, 0), s.test_answers, COALESCE(s.test_attempt_id, 0), s.course_draft, COALESCE(s.language, ''),
+		c.id, c.name, c.track, c.level, c.teacher, c.schedule, c.description, c.price, c.capacity
+	FROM user_states s
+	LEFT JOIN courses c ON c.id = s.selected_course_id
+	WHERE s.user_id = ?`
+
+	var state entities.UserState
+	var draft, answers sql.NullString
+	var courseID sql.NullInt64
+	var courseName, courseTrack, level, teacher, schedule, description sql.NullString
+	var price sql.NullFloat64
+	var capacity sql.NullInt64
+	err := r.queryRow(ctx, query, userID).Scan(
+		&state.Step, &state.Name, &state.PhoneNumber, &state.Track, &state.TestIndex, &state.TestScore, &state.IsTakingTest, &state.TestSeed, &answers, &state.TestAttemptID, &draft, &state.Language,
+		&courseID, &courseName, &courseTrack, &level, &teacher, &schedule, &description, &price, &capacity,
+	)
+	if err == sql.ErrNoRows {
+		return &entities.UserState{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("query user state: %w", err)
+	}
+
+	if answers.Valid && answers.String != "" {
+		if err := json.Unmarshal([]byte(answers.String), &state.TestAnswers); err != nil {
+			return nil, fmt.Errorf("decode test answers: %w", err)
+		}
+	}
+
+	if draft.Valid && draft.String != "" {
+		state.CourseDraft = &entities.CourseDraft{}
+		if err := json.Unmarshal([]byte(draft.String), state.CourseDraft); err != nil {
+			return nil, fmt.Errorf("decode course draft: %w", err)
+		}
+	}
+
+	if courseID.Valid {
+		state.Selected = &entities.Course{
+			ID:          courseID.Int64,
+			Name:        courseName.String,
+			Track:       courseTrack.String,
+			Level:       level.String,
+			Teacher:     teacher.String,
+			Schedule:    schedule.String,
+			Description: description.String,
+			Price:       price.Float64,
+			Capacity:    int(capacity.Int64),
+		}
+	}
+	return &state, nil
+}
+
+// SaveUserState сохраняет состояние диалога пользователя, перезаписывая предыдущее.
+func (r *sqlRepo) SaveUserState(ctx context.Context, userID int64, state *entities.UserState) error {
+	var selectedID sql.NullInt64
+	var selected sql.NullString
+	if state.Selected != nil {
+		selectedID = sql.NullInt64{Int64: state.Selected.ID, Valid: true}
+		selected = sql.NullString{String: state.Selected.Name, Valid: true}
+	}
+
+	var draft sql.NullString
+	if state.CourseDraft != nil {
+		data, err := json.Marshal(state.CourseDraft)
+		if err != nil {
+			return fmt.Errorf("encode course draft: %w", err)
+		}
+		draft = sql.NullString{String: string(data), Valid: true}
+	}
+
+	var answers sql.NullString
+	if len(state.TestAnswers) > 0 {
+		data, err := json.Marshal(state.TestAnswers)
+		if err != nil {
+			return fmt.Errorf("encode test answers: %w", err)
+		}
+		answers = sql.NullString{String: string(data), Valid: true}
+	}
+
+	query := `
+	INSERT INTO user_states(user_id, step, name, phone_number, selected_course_id, selected_course, track, test_index, test_score, is_taking_test, test_seed, test_answers, test_attempt_id, course_draft, language, updated_at)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	ON CONFLICT(user_id) DO UPDATE SET
+		step = excluded.step,
+		name = excluded.name,
+		phone_number = excluded.phone_number,
+		selected_course_id = excluded.selected_course_id,
+		selected_course = excluded.selected_course,
+		track = excluded.track,
+		test_index = excluded.test_index,
+		test_score = excluded.test_score,
+		is_taking_test = excluded.is_taking_test,
+		test_seed = excluded.test_seed,
+		test_answers = excluded.test_answers,
+		test_attempt_id = excluded.test_attempt_id,
+		course_draft = excluded.course_draft,
+		language = excluded.language,
+		updated_at = excluded.updated_at;`
+	_, err := r.exec(ctx, query, userID, state.Step, state.Name, state.PhoneNumber, selectedID, selected, state.Track,
+		state.TestIndex, state.TestScore, state.IsTakingTest, state.TestSeed, answers, state.TestAttemptID, draft, state.Language, time.Now())
+	if err != nil {
+		return fmt.Errorf("save user state: %w", err)
+	}
+	return nil
+}
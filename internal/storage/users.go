@@ -0,0 +1,66 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"tgbot/internal/entities"
+)
+
+// GetUser возвращает профиль пользователя или nil, если он ещё не знакомился с ботом.
+func (r *sqlRepo) GetUser(ctx context.Context, telegramID int64) (*entities.User, error) {
+	var u entities.User
+	var createdAt, lastSeenAt sql.NullTime
+	err := r.queryRow(ctx, `
+	SELECT telegram_id, name, phone_number, language, created_at, last_seen_at
+	FROM users WHERE telegram_id = ?`, telegramID).Scan(&u.TelegramID, &u.Name, &u.PhoneNumber, &u.Language, &createdAt, &lastSeenAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get user %d: %w", telegramID, err)
+	}
+	u.CreatedAt = createdAt.Time
+	u.LastSeenAt = lastSeenAt.Time
+	return &u, nil
+}
+
+// SaveUser создаёт или обновляет профиль. created_at задаётся только при создании.
+func (r *sqlRepo) SaveUser(ctx context.Context, user entities.User) error {
+	query := `
+	INSERT INTO users(telegram_id, name, phone_number, language, created_at, last_seen_at)
+	VALUES (?, ?, ?, ?, ?, ?)
+	ON CONFLICT(telegram_id) DO UPDATE SET
+		name = excluded.name,
+		phone_number = excluded.phone_number,
+		language = excluded.language,
+		last_seen_at = excluded.last_seen_at;`
+	_, err := r.exec(ctx, query, user.TelegramID, user.Name, user.PhoneNumber, user.Language, user.LastSeenAt, user.LastSeenAt)
+	if err != nil {
+		return fmt.Errorf("save user %d: %w", user.TelegramID, err)
+	}
+	return nil
+}
+
+// TouchUser отмечает время последнего сообщения. Для незнакомого
+// пользователя ничего не делает.
+func (r *sqlRepo) TouchUser(ctx context.Context, telegramID int64, now time.Time) error {
+	_, err := r.exec(ctx, `UPDATE users SET last_seen_at = ? WHERE telegram_id = ?`, now, telegramID)
+	return err
+}
+
+// FindUserByPhone возвращает профиль с номером phoneNumber в формате E.164
+// или nil, если такого номера нет.
+func (r *sqlRepo) FindUserByPhone(ctx context.Context, phoneNumber string) (*entities.User, error) {
+	var telegramID int64
+	err := r.queryRow(ctx, `SELECT telegram_id FROM users WHERE phone_number = ? ORDER BY last_seen_at DESC LIMIT 1`, phoneNumber).Scan(&telegramID)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("find user by phone: %w", err)
+	}
+	return r.GetUser(ctx, telegramID)
+}
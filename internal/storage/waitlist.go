@@ -0,0 +1,112 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"tgbot/internal/entities"
+)
+
+// Место в очереди считается среди ожидающих того же курса по порядку id.
+const waitlistColumns = `w.id, w.user_id, w.course_id, c.name, w.status, w.offer_expires_at,
+	CASE WHEN w.status = 'waiting' THEN
+		(SELECT COUNT(*) FROM waitlist p WHERE p.course_id = w.course_id AND p.status = 'waiting' AND p.id <= w.id)
+	ELSE 0 END`
+
+const waitlistFrom = `waitlist w JOIN courses c ON c.id = w.course_id`
+
+func scanWaitlistEntry(row rowScanner) (entities.WaitlistEntry, error) {
+	var e entities.WaitlistEntry
+	var expiresAt sql.NullTime
+	err := row.Scan(&e.ID, &e.UserID, &e.CourseID, &e.CourseName, &e.Status, &expiresAt, &e.Position)
+	if expiresAt.Valid {
+		e.OfferExpiresAt = expiresAt.Time
+	}
+	return e, err
+}
+
+func (r *sqlRepo) getWaitlistEntry(ctx context.Context, where string, args ...interface{}) (*entities.WaitlistEntry, error) {
+	e, err := scanWaitlistEntry(r.queryRow(ctx, `SELECT `+waitlistColumns+` FROM `+waitlistFrom+` WHERE `+where, args...))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("query waitlist: %w", err)
+	}
+	return &e, nil
+}
+
+// AddToWaitlist ставит пользователя в очередь на курс. Если он уже ждёт
+// или ему предложено место, возвращается существующая запись.
+func (r *sqlRepo) AddToWaitlist(ctx context.Context, userID, courseID int64, now time.Time) (*entities.WaitlistEntry, error) {
+	existing, err := r.getWaitlistEntry(ctx, `w.user_id = ? AND w.course_id = ? AND (w.status = ? OR (w.status = ? AND w.offer_expires_at > ?))
+		ORDER BY w.id LIMIT 1`, userID, courseID, entities.WaitlistWaiting, entities.WaitlistOffered, now)
+	if err != nil || existing != nil {
+		return existing, err
+	}
+
+	id, err := r.insert(ctx, `INSERT INTO waitlist(user_id, course_id, status, created_at, updated_at) VALUES (?, ?, ?, ?, ?)`,
+		userID, courseID, entities.WaitlistWaiting, now, now)
+	if err != nil {
+		return nil, fmt.Errorf("add to waitlist: %w", err)
+	}
+	return r.GetWaitlistEntry(ctx, id)
+}
+
+func (r *sqlRepo) GetWaitlistEntry(ctx context.Context, id int64) (*entities.WaitlistEntry, error) {
+	return r.getWaitlistEntry(ctx, `w.id = ?`, id)
+}
+
+// GetUserWaitlist возвращает очереди, в которых пользователь ждёт,
+// и действующие предложения места.
+func (r *sqlRepo) GetUserWaitlist(ctx context.Context, userID int64, now time.Time) ([]entities.WaitlistEntry, error) {
+	rows, err := r.query(ctx, `SELECT `+waitlistColumns+` FROM `+waitlistFrom+`
+		WHERE w.user_id = ? AND (w.status = ? OR (w.status = ? AND w.offer_expires_at > ?))
+		ORDER BY w.id`, userID, entities.WaitlistWaiting, entities.WaitlistOffered, now)
+	if err != nil {
+		return nil, fmt.Errorf("query user waitlist: %w", err)
+	}
+	defer rows.Close()
+
+	var entries []entities.WaitlistEntry
+	for rows.Next() {
+		e, err := scanWaitlistEntry(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan waitlist entry: %w", err)
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// NextWaiting возвращает первого в очереди на курс или nil, если очередь пуста.
+func (r *sqlRepo) NextWaiting(ctx context.Context, courseID int64) (*entities.WaitlistEntry, error) {
+	return r.getWaitlistEntry(ctx, `w.course_id = ? AND w.status = ? ORDER BY w.id LIMIT 1`, courseID, entities.WaitlistWaiting)
+}
+
+// ActiveOffer возвращает неистёкшее предложение места пользователю на курс.
+func (r *sqlRepo) ActiveOffer(ctx context.Context, userID, courseID int64, now time.Time) (*entities.WaitlistEntry, error) {
+	return r.getWaitlistEntry(ctx, `w.user_id = ? AND w.course_id = ? AND w.status = ? AND w.offer_expires_at > ? ORDER BY w.id LIMIT 1`,
+		userID, courseID, entities.WaitlistOffered, now)
+}
+
+// CountActiveOffers возвращает число мест, придержанных для пользователей из очереди.
+func (r *sqlRepo) CountActiveOffers(ctx context.Context, courseID int64, now time.Time) (int, error) {
+	var n int
+	err := r.queryRow(ctx, `SELECT COUNT(*) FROM waitlist WHERE course_id = ? AND status = ? AND offer_expires_at > ?`,
+		courseID, entities.WaitlistOffered, now).Scan(&n)
+	return n, err
+}
+
+func (r *sqlRepo) OfferSeat(ctx context.Context, id int64, expiresAt, now time.Time) error {
+	_, err := r.exec(ctx, `UPDATE waitlist SET status = ?, offer_expires_at = ?, updated_at = ? WHERE id = ?`,
+		entities.WaitlistOffered, expiresAt, now, id)
+	return err
+}
+
+func (r *sqlRepo) SetWaitlistStatus(ctx context.Context, id int64, status string, now time.Time) error {
+	_, err := r.exec(ctx, `UPDATE waitlist SET status = ?, updated_at = ? WHERE id = ?`, status, now, id)
+	return err
+}
@@ -0,0 +1,216 @@
+package tgbot
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+
+	"tgbot/internal/entities"
+	"tgbot/internal/i18n"
+	"tgbot/internal/storage"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+// Команды в порядке показа в /help и в меню Telegram. Описание команды
+// берётся из каталога по ключу "command.<имя без />".
+var (
+	// userCommands доступны всем, кроме шагов знакомства и теста.
+	userCommands = []string{"/courses", "/teachers", "/schedule", "/waitlist", "/profile", "/support", "/history"}
+	// staffCommands доступны ролям из commandRoles на любом шаге, в том
+	// числе во время знакомства и теста.
+	staffCommands = []string{
+		"/enrollments", "/cancelenrollment", "/testresults",
+		"/questions", "/answer", "/closequestion",
+		"/addcourse", "/editcourse", "/archivecourse",
+	}
+	// globalCommands работают на любом шаге, в том числе во время теста.
+	globalCommands = []string{"/help", "/cancel", "/restart", "/language"}
+)
+
+// handleGlobalCommand выполняет команду, которая важнее текущего шага
+// диалога, и сообщает, была ли command такой командой.
+func (b *Bot) handleGlobalCommand(ctx context.Context, userID, chatID int64, command, args string, us *entities.UserState) bool {
+	switch command {
+	case "/help":
+		b.sendHelp(ctx, userID, chatID, us)
+	case "/cancel":
+		b.cancelFlow(ctx, chatID, us)
+	case "/restart":
+		b.restart(ctx, chatID, us)
+	case "/language":
+		b.sendLanguages(ctx, chatID, us, args)
+	default:
+		return false
+	}
+	return true
+}
+
+func inFlow(us *entities.UserState) bool {
+	return State(us.Step) != StateIdle || us.IsTakingTest
+}
+
+// commandsFor возвращает команды пользователя с ролью role. Если us не nil,
+// остаются только команды, которые сработают на его текущем шаге.
+func commandsFor(role entities.Role, us *entities.UserState) []string {
+	var commands []string
+	if us == nil || !inOnboarding(us) {
+		commands = append(commands, userCommands...)
+	}
+	for _, command := range staffCommands {
+		if roleAllowed(role, commandRoles[command]) {
+			commands = append(commands, command)
+		}
+	}
+	for _, command := range globalCommands {
+		if command == "/cancel" && us != nil && !inFlow(us) {
+			continue
+		}
+		commands = append(commands, command)
+	}
+	return commands
+}
+
+func commandKey(command string) string {
+	return "command." + strings.TrimPrefix(command, "/")
+}
+
+// sendHelp перечисляет команды, доступные на текущем шаге с ролью пользователя.
+func (b *Bot) sendHelp(ctx context.Context, userID, chatID int64, us *entities.UserState) {
+	l := b.lang(us)
+	role, err := b.store.Admins.GetAdminRole(ctx, userID)
+	if err != nil {
+		log.Printf("Ошибка при проверке роли пользователя %d: %v", userID, err)
+	}
+
+	var sb strings.Builder
+	if inOnboarding(us) {
+		sb.WriteString(l.T("help.onboarding"))
+	} else {
+		sb.WriteString(l.T("help.header"))
+	}
+	for _, command := range commandsFor(role, us) {
+		sb.WriteString(fmt.Sprintf("%s — %s\n", command, l.T(commandKey(command))))
+	}
+	b.reply(ctx, chatID, sb.String())
+}
+
+// leaveFlow выходит из текущего диалога в свободное состояние, убирая за
+// собой: закрывает чат с менеджером, черновик курса и незаконченный тест.
+func (b *Bot) leaveFlow(ctx context.Context, chatID int64, us *entities.UserState) {
+	if State(us.Step) == StateSupport {
+		b.relayToSupport(ctx, chatID, us, b.langFor(ctx, b.supportChat).T("support.staff_closed"))
+	}
+	if us.IsTakingTest || State(us.Step) == StateTakingTest {
+		us.IsTakingTest = false
+		us.TestIndex = 0
+		us.TestScore = 0
+		us.TestAnswers = nil
+		us.TestAttemptID = 0
+	}
+	us.CourseDraft = nil
+	us.Step = string(StateIdle)
+}
+
+// cancelFlow обрабатывает /cancel. Знакомство пропустить нельзя: если
+// телефон ещё не получен, следующее сообщение начнёт его заново.
+func (b *Bot) cancelFlow(ctx context.Context, chatID int64, us *entities.UserState) {
+	l := b.lang(us)
+	if !inFlow(us) {
+		b.reply(ctx, chatID, l.T("cancel.nothing"))
+		return
+	}
+
+	step := State(us.Step)
+	b.leaveFlow(ctx, chatID, us)
+	if us.PhoneNumber == "" {
+		us.Name = ""
+		b.replyKeyboard(ctx, chatID, l.T("cancel.onboarding"), tgbotapi.NewRemoveKeyboard(false))
+		return
+	}
+	// Клавиатуру с кнопкой контакта нужно убрать явно
+	if step == StateProfilePhone {
+		b.replyKeyboard(ctx, chatID, l.T("cancel.done"), tgbotapi.NewRemoveKeyboard(false))
+		return
+	}
+	b.replyKeyboard(ctx, chatID, l.T("cancel.done"), b.chooseCourseKeyboard(us))
+}
+
+// restart обрабатывает /restart: имя, телефон и тест вводятся заново.
+// Язык сохраняется, а профиль в users обновится, когда будет введён телефон.
+func (b *Bot) restart(ctx context.Context, chatID int64, us *entities.UserState) {
+	b.leaveFlow(ctx, chatID, us)
+	*us = entities.UserState{Language: us.Language}
+	b.replyKeyboard(ctx, chatID, b.lang(us).T("restart.done"), tgbotapi.NewRemoveKeyboard(false))
+	if err := conversation.Jump(b, ctx, chatID, us, StateWaitingForName); err != nil {
+		log.Printf("Ошибка при перезапуске знакомства: %v", err)
+	}
+}
+
+// menuCommand — команда в меню клиента Telegram.
+type menuCommand struct {
+	Command     string `json:"command"`
+	Description string `json:"description"`
+}
+
+func menuCommands(l *i18n.Localizer, role entities.Role) []menuCommand {
+	commands := commandsFor(role, nil)
+	menu := make([]menuCommand, 0, len(commands))
+	for _, command := range commands {
+		menu = append(menu, menuCommand{
+			Command:     strings.TrimPrefix(command, "/"),
+			Description: l.T(commandKey(command)),
+		})
+	}
+	return menu
+}
+
+// registerCommands публикует меню команд: общее для всех пользователей и
+// отдельное для чата каждого сотрудника с командами его роли. Меню
+// отправляется на каждом языке каталога, основной язык — без language_code,
+// чтобы он показывался и пользователям с неподдерживаемым языком.
+func registerCommands(ctx context.Context, api *tgbotapi.BotAPI, admins storage.AdminRepository, catalogs *i18n.Bundle) error {
+	staff, err := admins.ListAdmins(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, lang := range catalogs.Languages() {
+		l := catalogs.Localizer(lang)
+		code := lang
+		if lang == i18n.DefaultLanguage {
+			code = ""
+		}
+		if err := setMyCommands(api, menuCommands(l, ""), `{"type":"default"}`, code); err != nil {
+			return fmt.Errorf("set default commands (%s): %w", lang, err)
+		}
+		for userID, role := range staff {
+			// Сотрудник, ещё не писавший боту, даёт ошибку «chat not found»:
+			// остальным меню всё равно нужно
+			scope := fmt.Sprintf(`{"type":"chat","chat_id":%d}`, userID)
+			if err := setMyCommands(api, menuCommands(l, role), scope, code); err != nil {
+				log.Printf("Ошибка при регистрации команд для сотрудника %d (%s): %v", userID, lang, err)
+			}
+		}
+	}
+	return nil
+}
+
+// setMyCommands вызывает метод Bot API, которого нет в tgbotapi.
+func setMyCommands(api *tgbotapi.BotAPI, commands []menuCommand, scope, languageCode string) error {
+	data, err := json.Marshal(commands)
+	if err != nil {
+		return err
+	}
+	params := url.Values{}
+	params.Set("commands", string(data))
+	params.Set("scope", scope)
+	if languageCode != "" {
+		params.Set("language_code", languageCode)
+	}
+	_, err = api.MakeRequest("setMyCommands", params)
+	return err
+}
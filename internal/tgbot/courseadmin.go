@@ -0,0 +1,507 @@
+package tgbot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"tgbot/internal/entities"
+	"tgbot/internal/i18n"
+	"tgbot/internal/quiz"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+// Диалог сотрудника для /addcourse, /editcourse и /archivecourse.
+// Черновик курса хранится в UserState.CourseDraft до подтверждения.
+const (
+	StateCoursePick      State = "course_pick"
+	StateCourseFieldPick State = "course_field_pick"
+	StateCourseField     State = "course_field"
+	StateCourseConfirm   State = "course_confirm"
+)
+
+func registerCourseAdmin(f *FSM) {
+	f.Register(StateCoursePick, StateDef{
+		Enter:  (*Bot).enterCoursePick,
+		Handle: (*Bot).handleCoursePick,
+		Next:   []State{StateCourseFieldPick, StateCourseConfirm, StateIdle},
+	})
+	f.Register(StateCourseFieldPick, StateDef{
+		Enter:  (*Bot).enterCourseFieldPick,
+		Handle: (*Bot).handleCourseFieldPick,
+		Next:   []State{StateCourseField, StateIdle},
+	})
+	f.Register(StateCourseField, StateDef{
+		Enter:  (*Bot).enterCourseField,
+		Handle: (*Bot).handleCourseField,
+		Next:   []State{StateCourseConfirm, StateIdle},
+	})
+	f.Register(StateCourseConfirm, StateDef{
+		Enter:  (*Bot).enterCourseConfirm,
+		Handle: (*Bot).handleCourseConfirm,
+		Next:   []State{StateIdle},
+	})
+}
+
+// courseField — поле курса, которое вводится в диалоге. label и prompt —
+// ключи каталога, args подставляются в них.
+type courseField struct {
+	label  string
+	prompt string
+	args   []any
+	get    func(l *i18n.Localizer, c *entities.Course) string
+	// set проверяет и записывает значение. Ошибка показывается сотруднику.
+	set func(c *entities.Course, value string) error
+	// options — варианты для кнопок. Ввод текстом тоже принимается.
+	options func(b *Bot, c *entities.Course) []string
+	// optionLabel — подпись кнопки варианта; nil — сам вариант.
+	optionLabel func(l *i18n.Localizer, c *entities.Course, option string) string
+}
+
+// fieldError — ошибка ввода поля курса. Текст берётся из каталога по key.
+type fieldError struct {
+	key  string
+	args []any
+}
+
+func (e *fieldError) Error() string {
+	return e.key
+}
+
+func invalidField(key string, args ...any) error {
+	return &fieldError{key: key, args: args}
+}
+
+var courseFields = []courseField{
+	{
+		label:  "course.field.name",
+		prompt: "course.prompt.name",
+		get:    func(_ *i18n.Localizer, c *entities.Course) string { return c.Name },
+		set:    func(c *entities.Course, v string) error { c.Name = v; return nil },
+	},
+	{
+		label:  "course.field.track",
+		prompt: "course.prompt.track",
+		get:    func(_ *i18n.Localizer, c *entities.Course) string { return c.Track },
+		set: func(c *entities.Course, v string) error {
+			c.Track = strings.ToLower(v)
+			return nil
+		},
+		options: func(b *Bot, _ *entities.Course) []string {
+			var tracks []string
+			for _, bank := range b.banks.List() {
+				tracks = append(tracks, bank.Track)
+			}
+			return tracks
+		},
+	},
+	{
+		label:  "course.field.level",
+		prompt: "course.prompt.level",
+		get:    func(l *i18n.Localizer, c *entities.Course) string { return levelName(l, c.Level) },
+		set: func(c *entities.Course, v string) error {
+			for _, level := range quiz.Levels {
+				if strings.EqualFold(v, level) {
+					c.Level = level
+					return nil
+				}
+			}
+			return invalidField("course.error.level", strings.Join(quiz.Levels, ", "))
+		},
+		options: func(*Bot, *entities.Course) []string { return quiz.Levels },
+		optionLabel: func(l *i18n.Localizer, _ *entities.Course, level string) string {
+			return levelName(l, level)
+		},
+	},
+	{
+		label:  "course.field.teacher",
+		prompt: "course.prompt.teacher",
+		get:    func(_ *i18n.Localizer, c *entities.Course) string { return c.Teacher },
+		set:    func(c *entities.Course, v string) error { c.Teacher = v; return nil },
+	},
+	{
+		label:  "course.field.schedule",
+		prompt: "course.prompt.schedule",
+		get:    func(_ *i18n.Localizer, c *entities.Course) string { return c.Schedule },
+		set:    func(c *entities.Course, v string) error { c.Schedule = v; return nil },
+	},
+	{
+		label:  "course.field.description",
+		prompt: "course.prompt.description",
+		get:    func(_ *i18n.Localizer, c *entities.Course) string { return c.Description },
+		set:    func(c *entities.Course, v string) error { c.Description = v; return nil },
+	},
+	{
+		label:  "course.field.price",
+		prompt: "course.prompt.price",
+		get:    func(_ *i18n.Localizer, c *entities.Course) string { return fmt.Sprintf("%.2f₽", c.Price) },
+		set: func(c *entities.Course, v string) error {
+			v = strings.NewReplacer(" ", "", "\u00a0", "", "₽", "", ",", ".").Replace(v)
+			price, err := strconv.ParseFloat(v, 64)
+			if err != nil || price <= 0 {
+				return invalidField("course.error.price")
+			}
+			c.Price = price
+			return nil
+		},
+	},
+	{
+		label:  "course.field.capacity",
+		prompt: "course.prompt.capacity",
+		get: func(l *i18n.Localizer, c *entities.Course) string {
+			if c.Capacity == 0 {
+				return l.T("course.unlimited")
+			}
+			return strconv.Itoa(c.Capacity)
+		},
+		set: func(c *entities.Course, v string) error {
+			capacity, err := strconv.Atoi(strings.TrimSpace(v))
+			if err != nil || capacity < 0 {
+				return invalidField("course.error.capacity")
+			}
+			c.Capacity = capacity
+			return nil
+		},
+	},
+}
+
+// courseFields возвращает поля курса, тему теста и после них — перевод
+// названия и описания на каждый язык, кроме основного. «-» удаляет перевод.
+func (b *Bot) courseFields() []courseField {
+	fields := append([]courseField(nil), courseFields...)
+	fields = append(fields, b.topicField())
+	for _, lang := range b.catalogs.Languages() {
+		if lang == i18n.DefaultLanguage {
+			continue
+		}
+		name := b.catalogs.Name(lang)
+		fields = append(fields,
+			translationField(lang, "course.field.name_in", "course.prompt.name_in", name,
+				func(t *entities.CourseTranslation) *string { return &t.Name }),
+			translationField(lang, "course.field.description_in", "course.prompt.description_in", name,
+				func(t *entities.CourseTranslation) *string { return &t.Description }),
+		)
+	}
+	return fields
+}
+
+// topicField — тема теста, по уровню в которой курс рекомендуется после
+// теста. Темы берутся из банка вопросов направления курса, «-» убирает тему.
+func (b *Bot) topicField() courseField {
+	return courseField{
+		label:  "course.field.topic",
+		prompt: "course.prompt.topic",
+		get: func(l *i18n.Localizer, c *entities.Course) string {
+			if c.Topic == "" {
+				return l.T("course.no_topic")
+			}
+			if bank, ok := b.banks.Get(c.Track); ok {
+				return bank.TopicName(c.Topic, l.Language())
+			}
+			return c.Topic
+		},
+		set: func(c *entities.Course, v string) error {
+			if v == "-" {
+				c.Topic = ""
+				return nil
+			}
+			bank, ok := b.banks.Get(c.Track)
+			if !ok || len(bank.Topics) == 0 {
+				return invalidField("course.error.no_topics", c.Track)
+			}
+			var ids []string
+			for _, t := range bank.Topics {
+				if strings.EqualFold(v, t.ID) || strings.EqualFold(v, t.Title) {
+					c.Topic = t.ID
+					return nil
+				}
+				ids = append(ids, t.ID)
+			}
+			return invalidField("course.error.topic", strings.Join(ids, ", "))
+		},
+		options: func(b *Bot, c *entities.Course) []string {
+			topics := []string{"-"}
+			if bank, ok := b.banks.Get(c.Track); ok {
+				for _, t := range bank.Topics {
+					topics = append(topics, t.ID)
+				}
+			}
+			return topics
+		},
+		optionLabel: func(l *i18n.Localizer, c *entities.Course, topic string) string {
+			if topic == "-" {
+				return l.T("course.no_topic")
+			}
+			if bank, ok := b.banks.Get(c.Track); ok {
+				return bank.TopicName(topic, l.Language())
+			}
+			return topic
+		},
+	}
+}
+
+func translationField(lang, label, prompt, langName string, field func(t *entities.CourseTranslation) *string) courseField {
+	return courseField{
+		label:  label,
+		prompt: prompt,
+		args:   []any{langName},
+		get: func(l *i18n.Localizer, c *entities.Course) string {
+			t := c.Translations[lang]
+			if v := *field(&t); v != "" {
+				return v
+			}
+			return l.T("course.no_translation")
+		},
+		set: func(c *entities.Course, v string) error {
+			if v == "-" {
+				v = ""
+			}
+			// Карту копируем: черновик мог получить её из общего списка курсов
+			translations := make(map[string]entities.CourseTranslation, len(c.Translations)+1)
+			for k, t := range c.Translations {
+				translations[k] = t
+			}
+			t := translations[lang]
+			*field(&t) = v
+			translations[lang] = t
+			c.Translations = translations
+			return nil
+		},
+	}
+}
+
+// startCourseDialog начинает диалог сотрудника. args — id курса для
+// /editcourse и /archivecourse, тогда шаг выбора курса пропускается.
+func (b *Bot) startCourseDialog(ctx context.Context, chatID int64, us *entities.UserState, action, args string) {
+	// Команды курсов доступны и во время теста: тест прерывается, как по /cancel
+	b.leaveFlow(ctx, chatID, us)
+	us.CourseDraft = &entities.CourseDraft{Action: action}
+
+	next := StateCoursePick
+	switch {
+	case action == entities.CourseAdd:
+		next = StateCourseField
+	case args != "":
+		id, err := strconv.ParseInt(args, 10, 64)
+		if course, ok := b.courseByID(id); err == nil && ok {
+			us.CourseDraft.Course = course
+			next = StateCourseFieldPick
+			if action == entities.CourseArchive {
+				next = StateCourseConfirm
+			}
+		}
+	}
+
+	if err := conversation.Jump(b, ctx, chatID, us, next); err != nil {
+		log.Printf("Ошибка при запуске диалога курса: %v", err)
+	}
+}
+
+// courseDialogCancelled прерывает диалог, если сотрудник нажал «Отмена»
+// или черновик курса потерян.
+func (b *Bot) courseDialogCancelled(ctx context.Context, in input, us *entities.UserState) bool {
+	if us.CourseDraft != nil && !b.isChoice(us, in.text, choiceCancel) {
+		return false
+	}
+	b.abortCourseDialog(ctx, in.chatID, us)
+	return true
+}
+
+func (b *Bot) abortCourseDialog(ctx context.Context, chatID int64, us *entities.UserState) {
+	us.CourseDraft = nil
+	b.reply(ctx, chatID, b.lang(us).T("admin.course_canceled"))
+}
+
+func (b *Bot) enterCoursePick(ctx context.Context, chatID int64, us *entities.UserState) {
+	courses := b.courseList()
+	buttons := make([]tgbotapi.InlineKeyboardButton, 0, len(courses)+1)
+	for _, course := range courses {
+		buttons = append(buttons, choiceButton(us, fmt.Sprintf("%d) %s", course.ID, course.Name), strconv.FormatInt(course.ID, 10)))
+	}
+	buttons = append(buttons, b.choiceButton(us, choiceCancel))
+	b.replyKeyboard(ctx, chatID, b.lang(us).T("admin.pick_course"), columnKeyboard(buttons...))
+}
+
+func (b *Bot) handleCoursePick(ctx context.Context, in input, us *entities.UserState) State {
+	if b.courseDialogCancelled(ctx, in, us) {
+		return StateIdle
+	}
+
+	id, err := strconv.ParseInt(strings.TrimSpace(in.text), 10, 64)
+	course, ok := b.courseByID(id)
+	if err != nil || !ok {
+		b.reply(ctx, in.chatID, b.lang(us).T("admin.course_not_found"))
+		return StateCoursePick
+	}
+
+	us.CourseDraft.Course = course
+	if us.CourseDraft.Action == entities.CourseArchive {
+		return StateCourseConfirm
+	}
+	return StateCourseFieldPick
+}
+
+func (b *Bot) enterCourseFieldPick(ctx context.Context, chatID int64, us *entities.UserState) {
+	l := b.lang(us)
+	fields := b.courseFields()
+	buttons := make([]tgbotapi.InlineKeyboardButton, 0, len(fields)+1)
+	for i, field := range fields {
+		buttons = append(buttons, choiceButton(us, l.T(field.label, field.args...), strconv.Itoa(i+1)))
+	}
+	buttons = append(buttons, b.choiceButton(us, choiceCancel))
+	b.replyKeyboard(ctx, chatID, l.T("admin.pick_field", us.CourseDraft.Course.Name), columnKeyboard(buttons...))
+}
+
+func (b *Bot) handleCourseFieldPick(ctx context.Context, in input, us *entities.UserState) State {
+	if b.courseDialogCancelled(ctx, in, us) {
+		return StateIdle
+	}
+
+	n, err := strconv.Atoi(strings.TrimSpace(in.text))
+	if err != nil || n < 1 || n > len(b.courseFields()) {
+		b.reply(ctx, in.chatID, b.lang(us).T("admin.pick_field_invalid"))
+		return StateCourseFieldPick
+	}
+	us.CourseDraft.Field = n - 1
+	return StateCourseField
+}
+
+func (b *Bot) enterCourseField(ctx context.Context, chatID int64, us *entities.UserState) {
+	b.promptCourseField(ctx, chatID, us)
+}
+
+func (b *Bot) promptCourseField(ctx context.Context, chatID int64, us *entities.UserState) {
+	l := b.lang(us)
+	field := b.courseFields()[us.CourseDraft.Field]
+	text := l.T(field.prompt, field.args...)
+	if us.CourseDraft.Action == entities.CourseEdit {
+		text = l.T("admin.current_value", field.get(l, &us.CourseDraft.Course), text)
+	}
+
+	var buttons []tgbotapi.InlineKeyboardButton
+	if field.options != nil {
+		for _, option := range field.options(b, &us.CourseDraft.Course) {
+			label := option
+			if field.optionLabel != nil {
+				label = field.optionLabel(l, &us.CourseDraft.Course, option)
+			}
+			buttons = append(buttons, choiceButton(us, label, option))
+		}
+	}
+	buttons = append(buttons, b.choiceButton(us, choiceCancel))
+	b.replyKeyboard(ctx, chatID, text, columnKeyboard(buttons...))
+}
+
+// handleCourseField сохраняет значение поля в черновик. При создании курса
+// поля вводятся по очереди, при редактировании — только выбранное.
+func (b *Bot) handleCourseField(ctx context.Context, in input, us *entities.UserState) State {
+	if b.courseDialogCancelled(ctx, in, us) {
+		return StateIdle
+	}
+
+	l := b.lang(us)
+	fields := b.courseFields()
+	value := strings.TrimSpace(in.text)
+	draft := us.CourseDraft
+	if draft.Field < 0 || draft.Field >= len(fields) {
+		draft.Field = 0
+	}
+	if value == "" {
+		b.reply(ctx, in.chatID, l.T("admin.empty_value"))
+		return StateCourseField
+	}
+	if err := fields[draft.Field].set(&draft.Course, value); err != nil {
+		var fe *fieldError
+		if errors.As(err, &fe) {
+			b.reply(ctx, in.chatID, l.T(fe.key, fe.args...))
+		} else {
+			b.reply(ctx, in.chatID, err.Error())
+		}
+		return StateCourseField
+	}
+
+	if draft.Action == entities.CourseAdd && draft.Field+1 < len(fields) {
+		draft.Field++
+		b.promptCourseField(ctx, in.chatID, us)
+		return StateCourseField
+	}
+	return StateCourseConfirm
+}
+
+func (b *Bot) enterCourseConfirm(ctx context.Context, chatID int64, us *entities.UserState) {
+	l := b.lang(us)
+	draft := us.CourseDraft
+
+	var sb strings.Builder
+	switch draft.Action {
+	case entities.CourseAdd:
+		sb.WriteString(l.T("admin.confirm_add"))
+	case entities.CourseEdit:
+		sb.WriteString(l.T("admin.confirm_edit"))
+	case entities.CourseArchive:
+		sb.WriteString(l.T("admin.confirm_archive"))
+	}
+	for _, field := range b.courseFields() {
+		sb.WriteString(fmt.Sprintf("%s: %s\n", l.T(field.label, field.args...), field.get(l, &draft.Course)))
+	}
+	b.replyKeyboard(ctx, chatID, sb.String(), b.yesNoKeyboard(us))
+}
+
+func (b *Bot) handleCourseConfirm(ctx context.Context, in input, us *entities.UserState) State {
+	if us.CourseDraft == nil {
+		b.abortCourseDialog(ctx, in.chatID, us)
+		return StateIdle
+	}
+
+	switch {
+	case b.isChoice(us, in.text, choiceYes):
+		b.applyCourseDraft(ctx, in.chatID, us)
+		us.CourseDraft = nil
+		return StateIdle
+	case b.isChoice(us, in.text, choiceNo):
+		b.abortCourseDialog(ctx, in.chatID, us)
+		return StateIdle
+	}
+
+	b.replyKeyboard(ctx, in.chatID, b.lang(us).T("common.yes_no"), b.yesNoKeyboard(us))
+	return StateCourseConfirm
+}
+
+func (b *Bot) applyCourseDraft(ctx context.Context, chatID int64, us *entities.UserState) {
+	l := b.lang(us)
+	draft := us.CourseDraft
+	var err error
+	var done string
+	switch draft.Action {
+	case entities.CourseAdd:
+		var id int64
+		id, err = b.store.Courses.CreateCourse(ctx, draft.Course)
+		done = l.T("admin.course_created", draft.Course.Name, id)
+	case entities.CourseEdit:
+		err = b.store.Courses.UpdateCourse(ctx, draft.Course)
+		done = l.T("admin.course_updated", draft.Course.Name)
+	case entities.CourseArchive:
+		err = b.store.Courses.ArchiveCourse(ctx, draft.Course.ID)
+		done = l.T("admin.course_archived", draft.Course.Name)
+	default:
+		err = fmt.Errorf("unknown course action %q", draft.Action)
+	}
+	if err != nil {
+		log.Printf("Ошибка при изменении курса: %v", err)
+		b.reply(ctx, chatID, l.T("admin.course_save_error"))
+		return
+	}
+
+	if err := b.refreshCourses(ctx); err != nil {
+		log.Printf("Ошибка при обновлении списка курсов: %v", err)
+	}
+	b.reply(ctx, chatID, done)
+	if draft.Action == entities.CourseEdit {
+		// Вместимость могла вырасти — места достаются листу ожидания
+		b.offerFreeSeats(ctx, draft.Course.ID)
+	}
+}
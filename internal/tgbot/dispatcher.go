@@ -0,0 +1,155 @@
+package tgbot
+
+import (
+	"log"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+// dispatcher раздаёт обновления по чатам: обновления одного чата
+// обрабатываются строго по очереди, разные чаты — параллельно,
+// но не более maxWorkers обработчиков одновременно.
+type dispatcher struct {
+	handle func(tgbotapi.Update)
+	sem    chan struct{}
+
+	mu     sync.Mutex
+	queues map[int64][]func()
+	timers map[*time.Timer]bool
+	closed bool
+	wg     sync.WaitGroup
+}
+
+func newDispatcher(maxWorkers int, handle func(tgbotapi.Update)) *dispatcher {
+	if maxWorkers < 1 {
+		maxWorkers = 1
+	}
+	return &dispatcher{
+		handle: handle,
+		sem:    make(chan struct{}, maxWorkers),
+		queues: make(map[int64][]func()),
+		timers: make(map[*time.Timer]bool),
+	}
+}
+
+// Dispatch ставит обновление в очередь его чата и при необходимости
+// запускает для чата обработчик.
+func (d *dispatcher) Dispatch(update tgbotapi.Update) {
+	chatID, ok := updateChatID(update)
+	if !ok {
+		return
+	}
+	d.enqueue(chatID, func() { d.handle(update) })
+}
+
+// After ставит fn в очередь чата через delay, как ещё одно обновление:
+// fn не выполняется одновременно с обработчиками этого чата. Отложенные
+// вызовы Wait тоже дожидается, а после Close они отменяются.
+func (d *dispatcher) After(chatID int64, delay time.Duration, fn func()) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.closed {
+		return
+	}
+	d.wg.Add(1)
+	var timer *time.Timer
+	timer = time.AfterFunc(delay, func() {
+		d.mu.Lock()
+		delete(d.timers, timer)
+		d.mu.Unlock()
+		d.enqueue(chatID, fn)
+		d.wg.Done()
+	})
+	d.timers[timer] = true
+}
+
+func (d *dispatcher) enqueue(chatID int64, fn func()) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.closed {
+		return
+	}
+	queue, active := d.queues[chatID]
+	d.queues[chatID] = append(queue, fn)
+	if !active {
+		d.wg.Add(1)
+		go d.work(chatID)
+	}
+}
+
+// Wait ждёт, пока будут обработаны все принятые обновления и отложенные
+// вызовы, или пока не закроется deadline. Возвращает false, если
+// обработчики не успели.
+func (d *dispatcher) Wait(deadline <-chan struct{}) bool {
+	done := make(chan struct{})
+	go func() {
+		d.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-deadline:
+		return false
+	}
+}
+
+// Close отменяет отложенные вызовы и ещё не начатые обновления. Начатые
+// обработчики доработают сами.
+func (d *dispatcher) Close() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.closed = true
+	for timer := range d.timers {
+		if timer.Stop() {
+			d.wg.Done()
+		}
+	}
+	d.timers = nil
+}
+
+func (d *dispatcher) work(chatID int64) {
+	defer d.wg.Done()
+	for {
+		d.mu.Lock()
+		queue := d.queues[chatID]
+		if len(queue) == 0 || d.closed {
+			delete(d.queues, chatID)
+			d.mu.Unlock()
+			return
+		}
+		fn := queue[0]
+		d.queues[chatID] = queue[1:]
+		d.mu.Unlock()
+
+		d.sem <- struct{}{}
+		d.process(chatID, fn)
+		<-d.sem
+	}
+}
+
+func (d *dispatcher) process(chatID int64, fn func()) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("Паника при обработке обновления чата %d: %v\n%s", chatID, r, debug.Stack())
+		}
+	}()
+	fn()
+}
+
+func updateChatID(update tgbotapi.Update) (int64, bool) {
+	if update.Message != nil && update.Message.Chat != nil {
+		return update.Message.Chat.ID, true
+	}
+	if cq := update.CallbackQuery; cq != nil && cq.Message != nil && cq.Message.Chat != nil {
+		return cq.Message.Chat.ID, true
+	}
+	// Счета выставляются только в личных чатах, где chat_id совпадает с id пользователя
+	if q := update.PreCheckoutQuery; q != nil && q.From != nil {
+		return int64(q.From.ID), true
+	}
+	return 0, false
+}
@@ -0,0 +1,135 @@
+package tgbot
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+func chatUpdate(chatID int64, text string) tgbotapi.Update {
+	return tgbotapi.Update{Message: &tgbotapi.Message{Text: text, Chat: &tgbotapi.Chat{ID: chatID}}}
+}
+
+func waitDispatcher(t *testing.T, d *dispatcher) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if !d.Wait(ctx.Done()) {
+		t.Fatal("обработчики не завершились")
+	}
+}
+
+func TestDispatcherSerializesChat(t *testing.T) {
+	var mu sync.Mutex
+	var got []string
+	running := 0
+	d := newDispatcher(4, func(update tgbotapi.Update) {
+		mu.Lock()
+		running++
+		overlap := running > 1
+		mu.Unlock()
+		if overlap {
+			t.Errorf("обновления одного чата обрабатываются одновременно")
+		}
+		time.Sleep(time.Millisecond)
+		mu.Lock()
+		running--
+		got = append(got, update.Message.Text)
+		mu.Unlock()
+	})
+
+	want := []string{"1", "2", "3", "4", "5"}
+	for _, text := range want {
+		d.Dispatch(chatUpdate(1, text))
+	}
+	waitDispatcher(t, d)
+	if len(got) != len(want) {
+		t.Fatalf("обработано %v, ожидалось %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("порядок %v, ожидался %v", got, want)
+		}
+	}
+}
+
+func TestDispatcherLimitsWorkers(t *testing.T) {
+	const workers, chats = 2, 5
+	release := make(chan struct{})
+	started := make(chan int64, chats)
+	d := newDispatcher(workers, func(update tgbotapi.Update) {
+		started <- update.Message.Chat.ID
+		<-release
+	})
+	for chatID := int64(1); chatID <= chats; chatID++ {
+		d.Dispatch(chatUpdate(chatID, "hi"))
+	}
+
+	// Разные чаты обрабатываются параллельно, но не больше workers сразу
+	for i := 0; i < workers; i++ {
+		select {
+		case <-started:
+		case <-time.After(time.Second):
+			t.Fatalf("параллельно запущено %d обработчиков, ожидалось %d", i, workers)
+		}
+	}
+	select {
+	case chatID := <-started:
+		t.Fatalf("чат %d запущен сверх лимита %d", chatID, workers)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+	waitDispatcher(t, d)
+	if len(started) != chats-workers {
+		t.Fatalf("после освобождения запущено %d обработчиков, ожидалось %d", len(started), chats-workers)
+	}
+}
+
+func TestDispatcherRecoversFromPanic(t *testing.T) {
+	var got []string
+	d := newDispatcher(1, func(update tgbotapi.Update) {
+		if update.Message.Text == "panic" {
+			panic("boom")
+		}
+		got = append(got, update.Message.Text)
+	})
+	d.Dispatch(chatUpdate(1, "panic"))
+	d.Dispatch(chatUpdate(1, "after"))
+	waitDispatcher(t, d)
+	if len(got) != 1 || got[0] != "after" {
+		t.Fatalf("после паники обработано %v", got)
+	}
+}
+
+func TestDispatcherAfter(t *testing.T) {
+	var mu sync.Mutex
+	var got []string
+	record := func(s string) {
+		mu.Lock()
+		got = append(got, s)
+		mu.Unlock()
+	}
+	d := newDispatcher(1, func(update tgbotapi.Update) { record(update.Message.Text) })
+
+	// Отложенный вызов Wait дожидается, и он встаёт в очередь чата
+	d.After(1, 10*time.Millisecond, func() { record("later") })
+	d.Dispatch(chatUpdate(1, "now"))
+	waitDispatcher(t, d)
+	if len(got) != 2 || got[0] != "now" || got[1] != "later" {
+		t.Fatalf("обработано %v", got)
+	}
+
+	// После Close отложенные вызовы отменяются
+	d.After(1, time.Hour, func() { record("never") })
+	d.Close()
+	waitDispatcher(t, d)
+	d.Dispatch(chatUpdate(1, "closed"))
+	waitDispatcher(t, d)
+	if len(got) != 2 {
+		t.Fatalf("после Close обработано %v", got)
+	}
+}
@@ -0,0 +1,525 @@
+package tgbot
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"tgbot/internal/entities"
+	"tgbot/internal/quiz"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+const (
+	StateIdle                   State = ""
+	StateWaitingForName         State = "waiting_for_name"
+	StateWaitingForPhone        State = "waiting_for_phone"
+	StateWaitingForTrack        State = "waiting_for_track"
+	StateTakingTest             State = "taking_test"
+	StateWaitingForCourse       State = "waiting_for_course_selection"
+	StateWaitingForPayment      State = "waiting_for_payment_confirmation"
+	StateWaitingForInvoice      State = "waiting_for_invoice_payment"
+	StateWaitingForQuestionsAsk State = "waiting_for_questions_prompt"
+	StateWaitingForQuestionText State = "waiting_for_question_text"
+)
+
+// conversation — граф диалога с абитуриентом.
+var conversation = newConversationFSM()
+
+// ConversationGraph возвращает граф диалога в формате Graphviz DOT.
+func ConversationGraph() string {
+	return conversation.DOT()
+}
+
+func newConversationFSM() *FSM {
+	f := NewFSM(StateIdle)
+
+	f.Register(StateIdle, StateDef{
+		Handle: (*Bot).handleIdle,
+		Next:   []State{StateWaitingForName, StateWaitingForCourse},
+	})
+	f.Register(StateWaitingForName, StateDef{
+		Enter:  (*Bot).enterName,
+		Handle: (*Bot).handleName,
+		Next:   []State{StateWaitingForPhone},
+	})
+	f.Register(StateWaitingForPhone, StateDef{
+		Enter:  (*Bot).enterPhone,
+		Handle: (*Bot).handlePhone,
+		Next:   []State{StateWaitingForTrack},
+	})
+	f.Register(StateWaitingForTrack, StateDef{
+		Enter:  (*Bot).enterTrack,
+		Handle: (*Bot).handleTrack,
+		Next:   []State{StateTakingTest},
+	})
+	f.Register(StateTakingTest, StateDef{
+		Enter:  (*Bot).enterTest,
+		Handle: (*Bot).handleTestStep,
+		Next:   []State{StateWaitingForCourse},
+	})
+	f.Register(StateWaitingForCourse, StateDef{
+		Enter:  (*Bot).enterCourseSelection,
+		Handle: (*Bot).handleCourseSelection,
+		Next:   []State{StateWaitingForPayment, StateWaitlistAsk},
+	})
+	f.Register(StateWaitingForPayment, StateDef{
+		Enter:  (*Bot).enterPaymentConfirmation,
+		Handle: (*Bot).handlePaymentConfirmation,
+		Next:   []State{StateWaitingForInvoice, StateIdle},
+	})
+	f.Register(StateWaitingForInvoice, StateDef{
+		Handle: (*Bot).handleInvoiceWaiting,
+		Next:   []State{StateWaitingForQuestionsAsk, StateWaitlistAsk, StateWaitingForCourse, StateIdle},
+	})
+	f.Register(StateWaitingForQuestionsAsk, StateDef{
+		Enter:  (*Bot).enterQuestionsPrompt,
+		Handle: (*Bot).handleQuestionsPrompt,
+		Next:   []State{StateWaitingForQuestionText, StateSupport, StateIdle},
+	})
+	f.Register(StateWaitingForQuestionText, StateDef{
+		Enter:  (*Bot).enterQuestionText,
+		Handle: (*Bot).handleQuestionText,
+		Next:   []State{StateIdle},
+	})
+	f.Register(StateSupport, StateDef{
+		Enter:  (*Bot).enterSupport,
+		Handle: (*Bot).handleSupport,
+		Next:   []State{StateIdle},
+	})
+	f.Register(StateWaitlistAsk, StateDef{
+		Enter:  (*Bot).enterWaitlistPrompt,
+		Handle: (*Bot).handleWaitlistPrompt,
+		Next:   []State{StateIdle},
+	})
+	registerCourseAdmin(f)
+	registerProfile(f)
+
+	return f
+}
+
+// inOnboarding сообщает, проходит ли пользователь знакомство или тест.
+// На этих шагах команды не обрабатываются, весь ввод идёт в автомат.
+func inOnboarding(us *entities.UserState) bool {
+	if us.IsTakingTest {
+		return true
+	}
+	switch State(us.Step) {
+	case StateWaitingForName, StateWaitingForPhone, StateWaitingForTrack, StateTakingTest:
+		return true
+	case StateIdle:
+		return us.Name == ""
+	}
+	return false
+}
+
+func (b *Bot) handleIdle(ctx context.Context, in input, us *entities.UserState) State {
+	if us.Name == "" {
+		return StateWaitingForName
+	}
+	if b.isChoice(us, in.text, choiceCourse) {
+		return StateWaitingForCourse
+	}
+
+	b.replyKeyboard(ctx, in.chatID, b.lang(us).T("idle.prompt"), b.chooseCourseKeyboard(us))
+	return StateIdle
+}
+
+func (b *Bot) enterName(ctx context.Context, chatID int64, us *entities.UserState) {
+	b.reply(ctx, chatID, b.lang(us).T("onboarding.name"))
+}
+
+func (b *Bot) handleName(ctx context.Context, in input, us *entities.UserState) State {
+	us.Name = strings.TrimSpace(in.text)
+	return StateWaitingForPhone
+}
+
+func (b *Bot) enterPhone(ctx context.Context, chatID int64, us *entities.UserState) {
+	b.replyKeyboard(ctx, chatID, b.lang(us).T("onboarding.phone"), b.contactKeyboard(us))
+}
+
+func (b *Bot) handlePhone(ctx context.Context, in input, us *entities.UserState) State {
+	phone, ok := b.readPhone(ctx, in, us, b.contactKeyboard(us))
+	if !ok {
+		return StateWaitingForPhone
+	}
+
+	us.PhoneNumber = phone
+	// С именем и телефоном пользователь уже знаком боту
+	b.saveUser(ctx, in.chatID, us)
+	// Убираем кнопку контакта: следующий шаг отвечает inline-кнопками
+	b.replyKeyboard(ctx, in.chatID, b.lang(us).T("onboarding.phone_saved", phone), tgbotapi.NewRemoveKeyboard(false))
+	return StateWaitingForTrack
+}
+
+// readPhone достаёт номер из контакта или текста и приводит его к E.164.
+// Если номер не подходит, объясняет почему и возвращает false.
+func (b *Bot) readPhone(ctx context.Context, in input, us *entities.UserState, keyboard tgbotapi.ReplyKeyboardMarkup) (string, bool) {
+	l := b.lang(us)
+	var phone string
+	var err error
+	if in.contact != nil {
+		// Номер из контакта проверен Telegram, но только если это контакт
+		// самого пользователя, а не пересланный чужой
+		if int64(in.contact.UserID) != in.chatID {
+			b.replyKeyboard(ctx, in.chatID, l.T("onboarding.phone_foreign_contact"), keyboard)
+			return "", false
+		}
+		phone = in.contact.PhoneNumber
+		if !strings.HasPrefix(phone, "+") {
+			phone = "+" + phone
+		}
+		phone, err = normalizePhone(phone)
+	} else {
+		phone, err = normalizePhone(in.text)
+	}
+	if err != nil {
+		b.replyKeyboard(ctx, in.chatID, l.T("onboarding.phone_invalid"), keyboard)
+		return "", false
+	}
+	return phone, true
+}
+
+func (b *Bot) enterTrack(ctx context.Context, chatID int64, us *entities.UserState) {
+	var buttons []tgbotapi.InlineKeyboardButton
+	for _, bank := range b.banks.List() {
+		buttons = append(buttons, choiceButton(us, bank.Title, bank.Track))
+	}
+	b.replyKeyboard(ctx, chatID, b.lang(us).T("onboarding.track"), columnKeyboard(buttons...))
+}
+
+func (b *Bot) handleTrack(ctx context.Context, in input, us *entities.UserState) State {
+	banks := b.banks.List()
+	number, err := parseCourseSelection(in.text)
+	if err == nil && number >= 1 && number <= len(banks) {
+		us.Track = banks[number-1].Track
+		return StateTakingTest
+	}
+	for _, bank := range banks {
+		if strings.EqualFold(in.text, bank.Title) || strings.EqualFold(in.text, bank.Track) {
+			us.Track = bank.Track
+			return StateTakingTest
+		}
+	}
+
+	b.reply(ctx, in.chatID, b.lang(us).T("onboarding.track_unknown"))
+	return StateWaitingForTrack
+}
+
+// testBank возвращает банк вопросов для направления пользователя.
+// Тесты, начатые до появления направлений, проходили по вопросам о Go.
+func (b *Bot) testBank(us *entities.UserState) *quiz.Bank {
+	if bank, ok := b.banks.Get(us.Track); ok {
+		return bank
+	}
+	if bank, ok := b.banks.Get("go"); ok {
+		return bank
+	}
+	return b.banks.List()[0]
+}
+
+// testSession восстанавливает адаптивный тест пользователя по seed и
+// сохранённым ответам.
+func testSession(bank *quiz.Bank, us *entities.UserState) *quiz.Session {
+	answers := make([]quiz.Answer, 0, len(us.TestAnswers))
+	for _, a := range us.TestAnswers {
+		answers = append(answers, quiz.Answer{Question: a.Question, Correct: a.Correct})
+	}
+	return quiz.Resume(bank, us.TestSeed, answers)
+}
+
+func (b *Bot) enterTest(ctx context.Context, chatID int64, us *entities.UserState) {
+	us.IsTakingTest = true
+	us.TestIndex = 0
+	us.TestScore = 0
+	us.TestSeed = b.jobs.Now().UnixNano()
+	us.TestAnswers = nil
+
+	bank := b.testBank(us)
+	b.startTestAttempt(ctx, chatID, bank, us)
+	session := testSession(bank, us)
+	b.reply(ctx, chatID, b.lang(us).N("test.start", session.Length(), us.Name, bank.Title, session.Length()))
+	b.sendTestQuestion(ctx, chatID, session, us)
+}
+
+func (b *Bot) sendTestQuestion(ctx context.Context, chatID int64, session *quiz.Session, us *entities.UserState) {
+	index, q, _ := session.Current()
+	b.recordTestQuestion(ctx, us, len(us.TestAnswers)+1, index, q)
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("❓ %s\n", q.Question))
+	buttons := make([]tgbotapi.InlineKeyboardButton, 0, len(q.Options))
+	for i, option := range q.Options {
+		sb.WriteString(fmt.Sprintf("%d) %s\n", i+1, option))
+		buttons = append(buttons, choiceButton(us, option, strconv.Itoa(i+1)))
+	}
+	b.replyKeyboard(ctx, chatID, sb.String(), columnKeyboard(buttons...))
+}
+
+func (b *Bot) handleTestStep(ctx context.Context, in input, us *entities.UserState) State {
+	bank := b.testBank(us)
+	session := testSession(bank, us)
+	index, question, ok := session.Current()
+	if !ok {
+		// Банк мог уменьшиться после перезапуска — завершаем тест с тем, что есть
+		return b.finishTest(ctx, in.chatID, bank, session, us)
+	}
+
+	answerIndex := -1
+	_, err := fmt.Sscanf(in.text, "%d", &answerIndex)
+
+	// Проверка: введено не число или номер вне списка вариантов
+	if err != nil || answerIndex < 1 || answerIndex > len(question.Options) {
+		b.reply(ctx, in.chatID, b.lang(us).T("test.number_range", len(question.Options)))
+		// Повторить текущий вопрос
+		b.sendTestQuestion(ctx, in.chatID, session, us)
+		return StateTakingTest
+	}
+
+	// Проверка ответа. Следующий вопрос зависит от предыдущих ответов
+	correct := session.Answer(answerIndex - 1)
+	us.TestAnswers = append(us.TestAnswers, entities.TestAnswer{Question: index, Correct: correct})
+	b.recordTestAnswer(ctx, us, len(us.TestAnswers), question, answerIndex-1, correct)
+	us.TestIndex = len(us.TestAnswers)
+	us.TestScore = session.Result().Correct
+
+	if !session.Done() {
+		// Следующий вопрос
+		b.sendTestQuestion(ctx, in.chatID, session, us)
+		return StateTakingTest
+	}
+
+	return b.finishTest(ctx, in.chatID, bank, session, us)
+}
+
+func (b *Bot) finishTest(ctx context.Context, chatID int64, bank *quiz.Bank, session *quiz.Session, us *entities.UserState) State {
+	result := session.Result()
+	us.IsTakingTest = false
+	us.TestScore = result.Correct
+	b.reply(ctx, chatID, b.lang(us).N("test.finished", result.Total, result.Correct, result.Total))
+	b.finishTestAttempt(ctx, us, result)
+	b.sendRecommendedCourses(ctx, chatID, us, bank, result)
+
+	// Список курсов приходит чуть позже рекомендаций, чтобы их успели
+	// прочитать. Обработчик чата при этом не ждёт: список встаёт в очередь
+	// чата и прочитает состояние уже после его сохранения. Шаг меняется
+	// здесь, чтобы автомат не отправил список сразу при входе в состояние.
+	us.Step = string(StateWaitingForCourse)
+	b.chats.After(chatID, courseListDelay, func() { b.sendDelayedCourseList(ctx, chatID) })
+	return StateWaitingForCourse
+}
+
+// courseListDelay — пауза между рекомендациями после теста и списком курсов.
+var courseListDelay = 2 * time.Second
+
+// sendDelayedCourseList отправляет список курсов после теста, если
+// пользователь ещё не выбрал курс и не ушёл с шага.
+func (b *Bot) sendDelayedCourseList(ctx context.Context, chatID int64) {
+	us, err := b.states.Get(ctx, chatID)
+	if err != nil {
+		log.Printf("Ошибка при получении состояния пользователя %d: %v", chatID, err)
+		return
+	}
+	if State(us.Step) != StateWaitingForCourse {
+		return
+	}
+	b.enterCourseSelection(ctx, chatID, us)
+}
+
+// levelForScore переводит долю правильных ответов в общий уровень: до
+// th.Beginner — начальный, до th.Intermediate — средний, выше — продвинутый.
+func levelForScore(score, total int, th LevelThresholds) string {
+	if total == 0 {
+		return "Начальный"
+	}
+	ratio := float64(score) / float64(total)
+	switch {
+	case ratio <= th.Beginner:
+		return "Начальный"
+	case ratio <= th.Intermediate:
+		return "Средний"
+	default:
+		return "Продвинутый"
+	}
+}
+
+// sendRecommendedCourses показывает уровень по каждой теме теста и курсы
+// направления, подходящие по теме и уровню. Курсы без темы и с темой,
+// которой не было в тесте, подбираются по общему уровню.
+func (b *Bot) sendRecommendedCourses(ctx context.Context, chatID int64, us *entities.UserState, bank *quiz.Bank, result quiz.Result) {
+	l := b.lang(us)
+	overall := levelForScore(result.Correct, result.Total, b.settings.Levels)
+
+	var sb strings.Builder
+	sb.WriteString(l.T("test.level", levelName(l, overall)))
+	for _, topic := range result.Topics {
+		sb.WriteString(l.T("test.topic_level", bank.TopicName(topic.Topic, l.Language()), levelName(l, topic.Level), topic.Correct, topic.Total))
+	}
+	sb.WriteString(l.T("test.recommended"))
+	// Курсы нумеруются по ID: этот номер пользователь потом вводит при выборе
+	found := false
+	for _, course := range b.courseList() {
+		if course.Track != bank.Track {
+			continue
+		}
+		level, ok := result.Level(course.Topic)
+		if !ok {
+			level = overall
+		}
+		if strings.EqualFold(course.Level, level) {
+			sb.WriteString(l.T("courses.item", course.ID, course.Localized(l.Language()).Name, course.Price))
+			found = true
+		}
+	}
+
+	if !found {
+		sb.WriteString(l.T("test.no_courses"))
+	}
+
+	b.reply(ctx, chatID, sb.String())
+}
+
+func (b *Bot) enterCourseSelection(ctx context.Context, chatID int64, us *entities.UserState) {
+	l := b.lang(us)
+	courses := b.courseList()
+	var sb strings.Builder
+	sb.WriteString(l.T("course.choose_header"))
+	for _, course := range courses {
+		local := course.Localized(l.Language())
+		sb.WriteString(l.T("course.card",
+			course.ID, local.Name, levelName(l, course.Level), course.Teacher, course.Schedule, local.Description, course.Price,
+		))
+		if course.Capacity > 0 {
+			free, err := b.freeSeats(ctx, course)
+			if err != nil {
+				log.Printf("Ошибка при подсчёте мест на курсе %d: %v", course.ID, err)
+			} else {
+				sb.WriteString(l.T("course.free_seats", max(free, 0), course.Capacity))
+			}
+		}
+		sb.WriteString("\n")
+	}
+	sb.WriteString(l.T("course.choose_footer"))
+
+	buttons := make([]tgbotapi.InlineKeyboardButton, 0, len(courses))
+	for _, course := range courses {
+		buttons = append(buttons, choiceButton(us, course.Localized(l.Language()).Name, strconv.FormatInt(course.ID, 10)))
+	}
+	b.replyKeyboard(ctx, chatID, sb.String(), columnKeyboard(buttons...))
+}
+
+// handleCourseSelection принимает номер курса из списка — это его id в базе,
+// поэтому выбор не зависит от порядка курсов в списке.
+func (b *Bot) handleCourseSelection(ctx context.Context, in input, us *entities.UserState) State {
+	courseNumber, err := parseCourseSelection(in.text)
+	course, ok := b.courseByID(int64(courseNumber))
+	if err != nil || !ok {
+		b.reply(ctx, in.chatID, b.lang(us).T("course.invalid_number"))
+		return StateWaitingForCourse
+	}
+
+	us.Selected = &course
+	available, err := b.seatAvailable(ctx, in.chatID, course)
+	if err != nil {
+		log.Printf("Ошибка при подсчёте мест на курсе %d: %v", course.ID, err)
+		b.reply(ctx, in.chatID, b.lang(us).T("course.seats_error"))
+		return StateWaitingForCourse
+	}
+	if !available {
+		return StateWaitlistAsk
+	}
+	return StateWaitingForPayment
+}
+
+func parseCourseSelection(input string) (int, error) {
+	var number int
+	_, err := fmt.Sscanf(input, "%d", &number)
+	return number, err
+}
+
+func (b *Bot) courseByID(id int64) (entities.Course, bool) {
+	for _, course := range b.courseList() {
+		if course.ID == id {
+			return course, true
+		}
+	}
+	return entities.Course{}, false
+}
+
+func (b *Bot) enterPaymentConfirmation(ctx context.Context, chatID int64, us *entities.UserState) {
+	l := b.lang(us)
+	b.replyKeyboard(ctx, chatID, l.T("payment.confirm", b.localCourse(l, *us.Selected).Name, us.Selected.Price), b.yesNoKeyboard(us))
+}
+
+func (b *Bot) handlePaymentConfirmation(ctx context.Context, in input, us *entities.UserState) State {
+	switch {
+	case b.isChoice(us, in.text, choiceYes):
+		if !b.sendInvoice(ctx, in.chatID, us) {
+			return StateWaitingForPayment
+		}
+		return StateWaitingForInvoice
+
+	case b.isChoice(us, in.text, choiceNo):
+		if _, err := b.store.Enrollments.SaveEnrollment(ctx, in.chatID, us.Selected.ID, false, us.TestScore); err != nil {
+			log.Printf("Ошибка при сохранении записи на курс: %v", err)
+		}
+		b.schedulePaymentReminder(ctx, in.chatID, us.Selected.ID)
+		b.replyKeyboard(ctx, in.chatID, b.lang(us).T("payment.postponed"), b.chooseCourseKeyboard(us))
+		return StateIdle
+	}
+
+	b.replyKeyboard(ctx, in.chatID, b.lang(us).T("payment.yes_no"), b.yesNoKeyboard(us))
+	return StateWaitingForPayment
+}
+
+// handleInvoiceWaiting отвечает, пока счёт не оплачен. Сам платёж приходит
+// отдельным обновлением и обрабатывается в handleSuccessfulPayment.
+func (b *Bot) handleInvoiceWaiting(ctx context.Context, in input, us *entities.UserState) State {
+	if b.isChoice(us, in.text, choiceCourse) {
+		return StateWaitingForCourse
+	}
+	b.replyKeyboard(ctx, in.chatID, b.lang(us).T("payment.awaiting_invoice"), columnKeyboard(b.choiceButton(us, choiceCourse)))
+	return StateWaitingForInvoice
+}
+
+func (b *Bot) enterQuestionsPrompt(ctx context.Context, chatID int64, us *entities.UserState) {
+	keyboard := b.yesNoKeyboard(us)
+	if b.supportChat != 0 {
+		keyboard.InlineKeyboard = append(keyboard.InlineKeyboard, tgbotapi.NewInlineKeyboardRow(b.choiceButton(us, choiceSupport)))
+	}
+	b.replyKeyboard(ctx, chatID, b.lang(us).T("questions.prompt"), keyboard)
+}
+
+func (b *Bot) handleQuestionsPrompt(ctx context.Context, in input, us *entities.UserState) State {
+	switch {
+	case b.isChoice(us, in.text, choiceYes):
+		return StateWaitingForQuestionText
+	case b.isChoice(us, in.text, choiceSupport) && b.supportChat != 0:
+		return StateSupport
+	case b.isChoice(us, in.text, choiceNo):
+		b.replyKeyboard(ctx, in.chatID, b.lang(us).T("questions.none"), b.chooseCourseKeyboard(us))
+		return StateIdle
+	}
+
+	b.replyKeyboard(ctx, in.chatID, b.lang(us).T("common.yes_no"), b.yesNoKeyboard(us))
+	return StateWaitingForQuestionsAsk
+}
+
+func (b *Bot) enterQuestionText(ctx context.Context, chatID int64, us *entities.UserState) {
+	b.reply(ctx, chatID, b.lang(us).T("questions.ask"))
+}
+
+func (b *Bot) handleQuestionText(ctx context.Context, in input, us *entities.UserState) State {
+	// Pass user's name and phone number when saving the question
+	id, err := b.store.Questions.SaveUserQuestion(ctx, in.chatID, us.Name, us.PhoneNumber, in.text)
+	if err != nil {
+		log.Printf("Ошибка при сохранении вопроса пользователя: %v", err)
+		b.reply(ctx, in.chatID, b.lang(us).T("questions.save_error"))
+	} else {
+		b.replyKeyboard(ctx, in.chatID, b.lang(us).T("questions.saved", id), b.chooseCourseKeyboard(us))
+	}
+	return StateIdle
+}
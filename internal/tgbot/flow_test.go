@@ -0,0 +1,529 @@
+package tgbot
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"tgbot/internal/entities"
+	"tgbot/internal/i18n"
+	"tgbot/internal/quiz"
+	"tgbot/internal/scheduler"
+	"tgbot/internal/storage"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+// testBot — бот на временной SQLite с RecordingMessenger и фейковыми
+// платежами. Ввод идёт через диспетчер, как в Run, и каждый шаг теста
+// дожидается всех обработчиков, в том числе отложенных.
+type testBot struct {
+	t     *testing.T
+	ctx   context.Context
+	bot   *Bot
+	store *storage.Store
+	msgr  *RecordingMessenger
+	clock *scheduler.FakeClock
+	jobs  *scheduler.Scheduler
+}
+
+func newTestBot(t *testing.T) *testBot {
+	t.Helper()
+	ctx := context.Background()
+	store, err := storage.InitDB(ctx, t.TempDir()+"/bot.db")
+	if err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	if err := store.Courses.SeedCourses(ctx); err != nil {
+		t.Fatalf("SeedCourses: %v", err)
+	}
+	banks, err := quiz.Load("")
+	if err != nil {
+		t.Fatalf("quiz.Load: %v", err)
+	}
+	catalogs, err := i18n.Load()
+	if err != nil {
+		t.Fatalf("i18n.Load: %v", err)
+	}
+
+	msgr := NewRecordingMessenger()
+	clock := scheduler.NewFakeClock(time.Date(2026, 9, 1, 10, 0, 0, 0, time.UTC))
+	jobs := scheduler.New(store.Jobs, clock)
+	bot, err := NewBot(ctx, store, msgr, banks, catalogs, NewFakePaymentProvider(msgr), jobs)
+	if err != nil {
+		t.Fatalf("NewBot: %v", err)
+	}
+	bot.chats = newDispatcher(maxConcurrentUpdates, func(update tgbotapi.Update) { bot.HandleConversation(ctx, update) })
+	t.Cleanup(bot.chats.Close)
+	// Список курсов после теста приходит сразу, иначе каждый шаг ждал бы паузу
+	courseListDelay = 0
+	t.Cleanup(func() { courseListDelay = 2 * time.Second })
+	return &testBot{t: t, ctx: ctx, bot: bot, store: store, msgr: msgr, clock: clock, jobs: jobs}
+}
+
+func (tb *testBot) user(chatID int64) *tgbotapi.User {
+	return &tgbotapi.User{ID: int(chatID), LanguageCode: "ru"}
+}
+
+// say отправляет боту текст от пользователя chatID. Перехваченные ранее
+// сообщения забываются, чтобы проверять только ответ на этот ввод.
+func (tb *testBot) say(chatID int64, text string) {
+	tb.msgr.Reset()
+	tb.handle(tgbotapi.Update{Message: &tgbotapi.Message{
+		Text: text,
+		Chat: &tgbotapi.Chat{ID: chatID},
+		From: tb.user(chatID),
+	}})
+}
+
+// handle передаёт обновление диспетчеру и ждёт, пока чат его обработает.
+func (tb *testBot) handle(update tgbotapi.Update) {
+	tb.t.Helper()
+	ctx, cancel := context.WithTimeout(tb.ctx, 5*time.Second)
+	defer cancel()
+	tb.bot.chats.Dispatch(update)
+	if !tb.bot.chats.Wait(ctx.Done()) {
+		tb.t.Fatal("обработчик не завершился")
+	}
+}
+
+// click нажимает кнопку label в последнем сообщении с инлайн-клавиатурой.
+// Как и say, забывает перехваченные ранее сообщения.
+func (tb *testBot) click(chatID int64, label string) {
+	tb.t.Helper()
+	sent := tb.msgr.Sent(chatID)
+	for i := len(sent) - 1; i >= 0; i-- {
+		keyboard, ok := sent[i].Keyboard.(tgbotapi.InlineKeyboardMarkup)
+		if !ok {
+			continue
+		}
+		for _, row := range keyboard.InlineKeyboard {
+			for _, button := range row {
+				if button.Text == label && button.CallbackData != nil {
+					tb.msgr.Reset()
+					tb.handle(tgbotapi.Update{CallbackQuery: &tgbotapi.CallbackQuery{
+						ID:      "cb-" + label,
+						Data:    *button.CallbackData,
+						From:    tb.user(chatID),
+						Message: &tgbotapi.Message{MessageID: sent[i].MessageID, Chat: &tgbotapi.Chat{ID: chatID}},
+					}})
+					return
+				}
+			}
+		}
+		break
+	}
+	tb.t.Fatalf("в последнем сообщении с клавиатурой нет кнопки %q", label)
+}
+
+// texts возвращает тексты сообщений чата после последнего ввода.
+func (tb *testBot) texts(chatID int64) []string {
+	var texts []string
+	for _, msg := range tb.msgr.Sent(chatID) {
+		texts = append(texts, msg.Text)
+	}
+	return texts
+}
+
+// expect проверяет, что в ответ на последний ввод в чат пришли ровно want.
+func (tb *testBot) expect(chatID int64, want ...string) {
+	tb.t.Helper()
+	got := tb.texts(chatID)
+	if len(got) != len(want) {
+		tb.t.Fatalf("сообщения: получено %d %q, ожидалось %d %q", len(got), got, len(want), want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			tb.t.Fatalf("сообщение %d:\nполучено  %q\nожидалось %q", i, got[i], want[i])
+		}
+	}
+}
+
+// waitFor ждёт сообщение, отправленное вне обработчика, например по таймеру.
+func (tb *testBot) waitFor(chatID int64, prefix string) SentMessage {
+	tb.t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		for _, msg := range tb.msgr.Sent(chatID) {
+			if strings.HasPrefix(msg.Text, prefix) {
+				return msg
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	tb.t.Fatalf("не дождались сообщения %q, получено %q", prefix, tb.texts(chatID))
+	return SentMessage{}
+}
+
+func (tb *testBot) state(chatID int64) *entities.UserState {
+	tb.t.Helper()
+	us, err := tb.bot.states.Get(tb.ctx, chatID)
+	if err != nil {
+		tb.t.Fatalf("states.Get: %v", err)
+	}
+	return us
+}
+
+// onboard проводит пользователя через знакомство и тест по направлению Go,
+// отвечая первым вариантом, до выбора курса.
+func (tb *testBot) onboard(chatID int64, name string) {
+	tb.t.Helper()
+	tb.say(chatID, "/start")
+	tb.say(chatID, name)
+	tb.say(chatID, fmt.Sprintf("+7 701 %07d", chatID))
+	tb.click(chatID, "Go")
+	bank, _ := tb.bot.banks.Get("go")
+	for i := 0; i < bank.TestLength(); i++ {
+		tb.say(chatID, "1")
+	}
+	if step := State(tb.state(chatID).Step); step != StateWaitingForCourse {
+		tb.t.Fatalf("после теста шаг %q", step)
+	}
+}
+
+// addStaff выдаёт пользователю роль сотрудника.
+func (tb *testBot) addStaff(userID int64, role entities.Role) {
+	tb.t.Helper()
+	if err := tb.store.Admins.SaveAdmin(tb.ctx, userID, role); err != nil {
+		tb.t.Fatalf("SaveAdmin: %v", err)
+	}
+}
+
+func TestConversationFromStartToInvoice(t *testing.T) {
+	tb := newTestBot(t)
+	const chatID = 42
+	l := tb.bot.catalogs.Localizer("ru")
+
+	tb.say(chatID, "/start")
+	tb.expect(chatID, l.T("onboarding.name"))
+
+	tb.say(chatID, "Иван")
+	tb.expect(chatID, l.T("onboarding.phone"))
+
+	tb.say(chatID, "+7 701 123-45-67")
+	tb.expect(chatID, l.T("onboarding.phone_saved", "+77011234567"), l.T("onboarding.track"))
+
+	tb.click(chatID, "Go")
+	if cb := tb.msgr.Callbacks(); len(cb) != 1 || cb[0].Text != "" {
+		t.Fatalf("ответ на нажатие кнопки направления: %+v", cb)
+	}
+	bank, _ := tb.bot.banks.Get("go")
+	sent := tb.msgr.Sent(chatID)
+	if len(sent) != 2 || sent[0].Text != l.N("test.start", bank.TestLength(), "Иван", bank.Title, bank.TestLength()) {
+		t.Fatalf("начало теста: %q", tb.texts(chatID))
+	}
+
+	// Отвечаем первым вариантом, пока тест не закончится. Каждый вопрос
+	// приходит с кнопками вариантов.
+	for i := 0; i < bank.TestLength(); i++ {
+		last := tb.msgr.Sent(chatID)
+		question := last[len(last)-1]
+		if !strings.HasPrefix(question.Text, "❓") {
+			t.Fatalf("вопрос %d: %q", i+1, question.Text)
+		}
+		if _, ok := question.Keyboard.(tgbotapi.InlineKeyboardMarkup); !ok {
+			t.Fatalf("вопрос %d без кнопок вариантов", i+1)
+		}
+		tb.say(chatID, "1")
+	}
+
+	us := tb.state(chatID)
+	if us.IsTakingTest || State(us.Step) != StateWaitingForCourse {
+		t.Fatalf("после теста: шаг %q, IsTakingTest=%v", us.Step, us.IsTakingTest)
+	}
+	if len(us.TestAnswers) != bank.TestLength() {
+		t.Fatalf("записано ответов: %d, ожидалось %d", len(us.TestAnswers), bank.TestLength())
+	}
+	finished := l.N("test.finished", bank.TestLength(), us.TestScore, bank.TestLength())
+	if got := tb.texts(chatID); len(got) < 2 || got[0] != finished {
+		t.Fatalf("итог теста: %q", got)
+	}
+	// Список курсов приходит после рекомендаций отдельным сообщением
+	list := tb.waitFor(chatID, l.T("course.choose_header"))
+	if _, ok := list.Keyboard.(tgbotapi.InlineKeyboardMarkup); !ok {
+		t.Fatal("список курсов без кнопок")
+	}
+
+	course, ok := tb.bot.courseByID(1)
+	if !ok {
+		t.Fatal("нет курса 1")
+	}
+	tb.say(chatID, "1")
+	tb.expect(chatID, l.T("payment.confirm", course.Name, course.Price))
+
+	tb.click(chatID, l.T("button.yes"))
+	invoices := tb.bot.payments.(*FakePaymentProvider).Invoices()
+	if len(invoices) != 1 {
+		t.Fatalf("выставлено счетов: %d", len(invoices))
+	}
+	inv := invoices[0]
+	if inv.Title != course.Name || inv.Amount != int(course.Price*100) {
+		t.Fatalf("счёт %+v не соответствует курсу %+v", inv, course)
+	}
+	if got := tb.texts(chatID); len(got) != 1 || !strings.Contains(got[0], course.Name) {
+		t.Fatalf("сообщение со счётом: %q", got)
+	}
+	if State(tb.state(chatID).Step) != StateWaitingForInvoice {
+		t.Fatalf("после счёта шаг %q", tb.state(chatID).Step)
+	}
+
+	enrollments, err := tb.store.Enrollments.GetEnrollmentsByUserIDAndCourse(tb.ctx, chatID, course.ID)
+	if err != nil {
+		t.Fatalf("GetEnrollmentsByUserIDAndCourse: %v", err)
+	}
+	if len(enrollments) != 1 || enrollments[0].ID != inv.EnrollmentID || enrollments[0].IsPaid {
+		t.Fatalf("записи на курс: %+v", enrollments)
+	}
+}
+
+func TestAnswerQuestion(t *testing.T) {
+	tb := newTestBot(t)
+	l := tb.bot.catalogs.Localizer("ru")
+	const userID, teacherID = 42, 1
+	tb.addStaff(teacherID, entities.RoleTeacher)
+
+	// Пользователь оплачивает курс и задаёт вопрос
+	tb.onboard(userID, "Иван")
+	tb.say(userID, "1")
+	tb.click(userID, l.T("button.yes"))
+	tb.click(userID, "Оплатить (тест)")
+	tb.expect(userID, l.T("payment.success"), l.T("questions.prompt"))
+	tb.click(userID, l.T("button.yes"))
+	tb.expect(userID, l.T("questions.ask"))
+	tb.say(userID, "Занятия онлайн?")
+	questions, err := tb.store.Questions.GetUserQuestions(tb.ctx, entities.QuestionOpen)
+	if err != nil || len(questions) != 1 {
+		t.Fatalf("открытые вопросы: %+v, %v", questions, err)
+	}
+	id := questions[0].ID
+	tb.expect(userID, l.T("questions.saved", id))
+
+	tb.say(teacherID, "/answer")
+	tb.expect(teacherID, l.T("questions.answer_usage"))
+	tb.say(teacherID, fmt.Sprintf("/answer %d", id))
+	tb.expect(teacherID, l.T("questions.answer_usage"))
+	tb.say(teacherID, "/answer 999 Да")
+	tb.expect(teacherID, l.T("questions.not_found"))
+
+	// Ответ приходит автору вопроса, а вопрос становится отвеченным
+	tb.say(teacherID, fmt.Sprintf("/answer №%d Да, онлайн", id))
+	tb.expect(teacherID, l.T("questions.answer_sent", id, "Иван"))
+	tb.expect(userID, l.T("questions.answer_to_user", "Занятия онлайн?", "Да, онлайн"))
+	q, err := tb.store.Questions.GetUserQuestion(tb.ctx, id)
+	if err != nil || q == nil || q.Status != entities.QuestionAnswered || q.Answer != "Да, онлайн" {
+		t.Fatalf("вопрос после ответа: %+v, %v", q, err)
+	}
+
+	// Пользователю команда недоступна, а на закрытый вопрос ответить нельзя
+	tb.say(userID, fmt.Sprintf("/answer %d Сам себе", id))
+	tb.expect(userID, l.T("common.staff_only"))
+	tb.say(teacherID, fmt.Sprintf("/closequestion %d", id))
+	tb.expect(teacherID, l.T("questions.closed", id))
+	tb.say(teacherID, fmt.Sprintf("/answer %d Ещё раз", id))
+	tb.expect(teacherID, l.T("questions.closed_no_answer", id))
+	if got := tb.texts(userID); len(got) != 0 {
+		t.Fatalf("пользователю пришло %q", got)
+	}
+}
+
+func TestSupportRelay(t *testing.T) {
+	tb := newTestBot(t)
+	l := tb.bot.catalogs.Localizer("ru")
+	const userID, groupID = 42, -100
+	tb.bot.supportChat = groupID
+	header := l.T("support.staff_header", "Иван", "+77010000042", userID)
+	groupReply := func(messageID, replyTo int, text string) {
+		tb.msgr.Reset()
+		msg := &tgbotapi.Message{MessageID: messageID, Text: text, Chat: &tgbotapi.Chat{ID: groupID}, From: tb.user(1)}
+		if replyTo != 0 {
+			msg.ReplyToMessage = &tgbotapi.Message{MessageID: replyTo}
+		}
+		tb.handle(tgbotapi.Update{Message: msg})
+	}
+
+	tb.onboard(userID, "Иван")
+	tb.say(userID, "/support")
+	tb.expect(userID, l.T("support.connected"))
+	tb.expect(groupID, header+"\n\n"+l.T("support.staff_opened"))
+
+	// Сообщение пользователя копируется в группу с заголовком об авторе
+	tb.say(userID, "Когда начало занятий?")
+	tb.expect(userID)
+	tb.expect(groupID, header+"\n\nКогда начало занятий?")
+	copied := tb.msgr.Sent(groupID)[0].MessageID
+
+	// Ответ на копию приходит пользователю, переписка без reply — нет
+	groupReply(1000, 0, "Кто ответит?")
+	tb.expect(userID)
+	groupReply(1001, copied, "В понедельник")
+	tb.expect(userID, l.T("support.manager_reply", "В понедельник"))
+	// Ответ на ответ менеджера тоже доходит
+	groupReply(1002, 1001, "В 19:00")
+	tb.expect(userID, l.T("support.manager_reply", "В 19:00"))
+	tb.expect(groupID)
+
+	// Кроме кнопки, чат закрывает команда /endsupport
+	tb.say(userID, "/endsupport")
+	tb.expect(userID, l.T("support.ended"))
+	tb.expect(groupID, header+"\n\n"+l.T("support.staff_closed"))
+	if step := State(tb.state(userID).Step); step != StateIdle {
+		t.Fatalf("после чата шаг %q", step)
+	}
+}
+
+func TestProfile(t *testing.T) {
+	tb := newTestBot(t)
+	l := tb.bot.catalogs.Localizer("ru")
+	const userID = 42
+	card := func(name, phone string) string { return l.T("profile.card", name, phone, "Русский") }
+
+	tb.onboard(userID, "Иван")
+	tb.say(userID, "/profile")
+	tb.expect(userID, card("Иван", "+77010000042"))
+
+	tb.say(userID, "Что здесь?")
+	tb.expect(userID, l.T("profile.pick_action"))
+	tb.say(userID, "/profile")
+
+	tb.click(userID, l.T("button.edit_name"))
+	tb.expect(userID, l.T("profile.name_prompt"))
+	tb.say(userID, "  ")
+	tb.expect(userID, l.T("admin.empty_value"))
+	tb.say(userID, "Пётр")
+	tb.expect(userID, l.T("profile.name_saved", "Пётр"), card("Пётр", "+77010000042"))
+
+	tb.click(userID, l.T("button.edit_phone"))
+	tb.expect(userID, l.T("profile.phone_prompt"))
+	tb.say(userID, "123")
+	tb.expect(userID, l.T("onboarding.phone_invalid"))
+	tb.say(userID, l.T("button.cancel"))
+	tb.expect(userID, l.T("profile.phone_unchanged"), card("Пётр", "+77010000042"))
+
+	tb.click(userID, l.T("button.edit_phone"))
+	tb.say(userID, "8 701 765 43 21")
+	tb.expect(userID, l.T("onboarding.phone_saved", "+77017654321"), card("Пётр", "+77017654321"))
+
+	tb.click(userID, l.T("button.done"))
+	tb.expect(userID, l.T("profile.closed"))
+	if step := State(tb.state(userID).Step); step != StateIdle {
+		t.Fatalf("после профиля шаг %q", step)
+	}
+	user, err := tb.store.Users.GetUser(tb.ctx, userID)
+	if err != nil || user == nil || user.Name != "Пётр" || user.PhoneNumber != "+77017654321" {
+		t.Fatalf("профиль: %+v, %v", user, err)
+	}
+
+	// Состояние диалога потеряно, но профиль узнаёт пользователя
+	tb.bot.states.Save(tb.ctx, userID, &entities.UserState{})
+	tb.say(userID, "/profile")
+	tb.expect(userID, l.T("profile.welcome_back", "Пётр"), card("Пётр", "+77017654321"))
+}
+
+func TestCancelAndRestart(t *testing.T) {
+	tb := newTestBot(t)
+	l := tb.bot.catalogs.Localizer("ru")
+	const userID = 42
+
+	// Знакомство без телефона прерывается целиком и начинается заново
+	tb.say(userID, "/start")
+	tb.say(userID, "Иван")
+	tb.say(userID, "/cancel")
+	tb.expect(userID, l.T("cancel.onboarding"))
+	if us := tb.state(userID); us.Name != "" || State(us.Step) != StateIdle {
+		t.Fatalf("после отмены знакомства: %+v", us)
+	}
+	tb.say(userID, "/cancel")
+	tb.expect(userID, l.T("cancel.nothing"))
+	tb.say(userID, "Привет")
+	tb.expect(userID, l.T("onboarding.name"))
+
+	// Отмена теста сбрасывает ответы и попытку, но не знакомство
+	tb.say(userID, "Иван")
+	tb.say(userID, "+7 701 123-45-67")
+	tb.click(userID, "Go")
+	tb.say(userID, "1")
+	tb.say(userID, "/help")
+	if got := tb.texts(userID); len(got) != 1 || !strings.HasPrefix(got[0], l.T("help.onboarding")) || !strings.Contains(got[0], "/cancel") || strings.Contains(got[0], "/courses") {
+		t.Fatalf("/help во время теста: %q", got)
+	}
+	tb.say(userID, "/cancel")
+	tb.expect(userID, l.T("cancel.done"))
+	us := tb.state(userID)
+	if us.IsTakingTest || State(us.Step) != StateIdle || len(us.TestAnswers) != 0 || us.TestAttemptID != 0 || us.Name != "Иван" {
+		t.Fatalf("после отмены теста: %+v", us)
+	}
+	tb.say(userID, "/help")
+	if got := tb.texts(userID); len(got) != 1 || !strings.HasPrefix(got[0], l.T("help.header")) || strings.Contains(got[0], "/cancel") {
+		t.Fatalf("/help без диалога: %q", got)
+	}
+
+	// /restart начинает знакомство заново, сохраняя язык
+	tb.say(userID, "/restart")
+	tb.expect(userID, l.T("restart.done"), l.T("onboarding.name"))
+	us = tb.state(userID)
+	if us.Name != "" || us.PhoneNumber != "" || us.Language != "ru" || State(us.Step) != StateWaitingForName {
+		t.Fatalf("после /restart: %+v", us)
+	}
+	// Профиль в users остаётся, но не подставляется вместо нового знакомства
+	tb.say(userID, "Пётр")
+	tb.expect(userID, l.T("onboarding.phone"))
+}
+
+func TestTestResults(t *testing.T) {
+	tb := newTestBot(t)
+	l := tb.bot.catalogs.Localizer("ru")
+	const teacherID, finishedID, unfinishedID = 1, 42, 43
+	tb.addStaff(teacherID, entities.RoleTeacher)
+	output := func() string { return strings.Join(tb.texts(teacherID), "") }
+
+	tb.say(teacherID, "/testresults")
+	tb.expect(teacherID, l.T("testresults.empty"))
+
+	tb.onboard(finishedID, "Иван")
+	tb.say(unfinishedID, "/start")
+	tb.say(unfinishedID, "Пётр")
+	tb.say(unfinishedID, "+7 701 000 00 43")
+	tb.click(unfinishedID, "Go")
+	tb.say(unfinishedID, "1")
+
+	attempts, err := tb.store.Tests.GetTestAttempts(tb.ctx, finishedID)
+	if err != nil || len(attempts) != 1 || !attempts[0].Finished() {
+		t.Fatalf("попытки пользователя %d: %+v, %v", finishedID, attempts, err)
+	}
+	finished := attempts[0]
+	score := l.T("testresults.score", finished.Score, finished.Total, levelName(l, finished.Level))
+
+	// Последние попытки всех пользователей
+	tb.say(teacherID, "/testresults")
+	got := output()
+	for _, want := range []string{l.T("testresults.header"), score, l.T("testresults.unfinished"), l.T("testresults.not_enrolled"), l.T("testresults.footer")} {
+		if !strings.Contains(got, want) {
+			t.Fatalf("в /testresults нет %q:\n%s", want, got)
+		}
+	}
+
+	// Попытка по телефону — с ответом на каждый вопрос. Строка ответа
+	// заканчивается временем, которое ушло на вопрос.
+	tb.say(teacherID, "/testresults +7 701 000-00-42")
+	got = output()
+	if !strings.Contains(got, score) || strings.Count(got, " с\n") != finished.Total || strings.Contains(got, l.T("testresults.no_answer")) {
+		t.Fatalf("/testresults по телефону:\n%s", got)
+	}
+
+	// Незаконченная попытка по Telegram ID: показанный вопрос без ответа
+	tb.say(teacherID, "/testresults 43")
+	got = output()
+	if !strings.Contains(got, l.T("testresults.unfinished")) || strings.Count(got, " с\n") != 1 || !strings.Contains(got, l.T("testresults.no_answer")) {
+		t.Fatalf("/testresults по ID:\n%s", got)
+	}
+
+	tb.say(teacherID, "/testresults +7 999 000-00-00")
+	tb.expect(teacherID, l.T("testresults.not_found", "+7 999 000-00-00"))
+	tb.say(teacherID, "/testresults 77")
+	tb.expect(teacherID, l.T("testresults.user_empty", 77))
+	tb.say(finishedID, "/testresults")
+	tb.expect(finishedID, l.T("common.staff_only"))
+}
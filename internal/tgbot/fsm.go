@@ -0,0 +1,151 @@
+package tgbot
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"tgbot/internal/entities"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+// State — шаг диалога. Значение хранится в entities.UserState.Step.
+type State string
+
+func (s State) String() string {
+	if s == StateIdle {
+		return "idle"
+	}
+	return string(s)
+}
+
+// input — то, что пользователь прислал на текущем шаге.
+type input struct {
+	chatID int64
+	text   string
+	// contact — контакт, отправленный кнопкой «Поделиться контактом» или вложением.
+	contact *tgbotapi.Contact
+}
+
+// StateDef описывает один шаг диалога.
+type StateDef struct {
+	// Enter отправляет сообщение при входе в состояние. Может быть nil.
+	Enter func(b *Bot, ctx context.Context, chatID int64, us *entities.UserState)
+	// Handle обрабатывает ввод и возвращает следующее состояние.
+	// Возврат текущего состояния означает «остаться на шаге».
+	Handle func(b *Bot, ctx context.Context, in input, us *entities.UserState) State
+	// Next — состояния, в которые разрешено переходить из этого.
+	Next []State
+}
+
+// FSM — конечный автомат диалога. Переходы, не объявленные в StateDef.Next,
+// отклоняются и логируются.
+type FSM struct {
+	initial State
+	states  map[State]StateDef
+	order   []State
+}
+
+func NewFSM(initial State) *FSM {
+	return &FSM{
+		initial: initial,
+		states:  make(map[State]StateDef),
+	}
+}
+
+func (f *FSM) Register(s State, def StateDef) {
+	if _, exists := f.states[s]; !exists {
+		f.order = append(f.order, s)
+	}
+	f.states[s] = def
+}
+
+// Handle передаёт ввод обработчику текущего состояния и выполняет переход.
+func (f *FSM) Handle(b *Bot, ctx context.Context, in input, us *entities.UserState) {
+	current := State(us.Step)
+	def, ok := f.states[current]
+	if !ok {
+		log.Printf("Неизвестное состояние %q у пользователя %d, сброс в %s", us.Step, in.chatID, f.initial)
+		b.reply(ctx, in.chatID, b.lang(us).T("common.unknown_step"))
+		us.Step = string(f.initial)
+		return
+	}
+
+	next := def.Handle(b, ctx, in, us)
+	if next == current {
+		return
+	}
+	if State(us.Step) == next {
+		// Обработчик сам сменил шаг, чтобы отправить сообщение входа позже
+		if !f.Allowed(current, next) {
+			log.Printf("Переход отклонён для пользователя %d: transition %s -> %s is not allowed", in.chatID, current, next)
+			us.Step = string(current)
+		}
+		return
+	}
+	if err := f.Transition(b, ctx, in.chatID, us, next); err != nil {
+		log.Printf("Переход отклонён для пользователя %d: %v", in.chatID, err)
+	}
+}
+
+// Transition переводит пользователя в состояние to и отправляет сообщение
+// входа. Недопустимый переход оставляет пользователя в текущем состоянии.
+func (f *FSM) Transition(b *Bot, ctx context.Context, chatID int64, us *entities.UserState, to State) error {
+	from := State(us.Step)
+	if !f.Allowed(from, to) {
+		return fmt.Errorf("transition %s -> %s is not allowed", from, to)
+	}
+
+	us.Step = string(to)
+	if enter := f.states[to].Enter; enter != nil {
+		enter(b, ctx, chatID, us)
+	}
+	return nil
+}
+
+// Jump переводит пользователя в состояние to из любого состояния. Нужен
+// командам, которые прерывают текущий шаг и начинают свой диалог.
+func (f *FSM) Jump(b *Bot, ctx context.Context, chatID int64, us *entities.UserState, to State) error {
+	if _, ok := f.states[to]; !ok {
+		return fmt.Errorf("unknown state %s", to)
+	}
+
+	us.Step = string(to)
+	if enter := f.states[to].Enter; enter != nil {
+		enter(b, ctx, chatID, us)
+	}
+	return nil
+}
+
+func (f *FSM) Allowed(from, to State) bool {
+	def, ok := f.states[from]
+	if !ok {
+		return false
+	}
+	if _, ok := f.states[to]; !ok {
+		return false
+	}
+	for _, s := range def.Next {
+		if s == to {
+			return true
+		}
+	}
+	return false
+}
+
+// DOT возвращает граф состояний в формате Graphviz.
+func (f *FSM) DOT() string {
+	var sb strings.Builder
+	sb.WriteString("digraph conversation {\n")
+	sb.WriteString("\trankdir=LR;\n")
+	sb.WriteString(fmt.Sprintf("\t%q [shape=doublecircle];\n", f.initial.String()))
+	for _, s := range f.order {
+		for _, next := range f.states[s].Next {
+			sb.WriteString(fmt.Sprintf("\t%q -> %q;\n", s.String(), next.String()))
+		}
+	}
+	sb.WriteString("}\n")
+	return sb.String()
+}
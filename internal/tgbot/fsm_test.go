@@ -0,0 +1,134 @@
+package tgbot
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"tgbot/internal/entities"
+)
+
+// testFSM — автомат a -> b -> c. Обработчик переходит в состояние, названное
+// во вводе, а ввод "set:X" сначала сам меняет шаг на X. Вход в состояние
+// записывается в entered.
+func testFSM(entered *[]State) *FSM {
+	enter := func(s State) func(b *Bot, ctx context.Context, chatID int64, us *entities.UserState) {
+		return func(b *Bot, ctx context.Context, chatID int64, us *entities.UserState) {
+			*entered = append(*entered, s)
+		}
+	}
+	handle := func(b *Bot, ctx context.Context, in input, us *entities.UserState) State {
+		if strings.HasPrefix(in.text, "set:") {
+			// Обработчик сам меняет шаг, как finishTest
+			us.Step = strings.TrimPrefix(in.text, "set:")
+		}
+		return State(strings.TrimPrefix(in.text, "set:"))
+	}
+	f := NewFSM("a")
+	f.Register("a", StateDef{Enter: enter("a"), Handle: handle, Next: []State{"b"}})
+	f.Register("b", StateDef{Enter: enter("b"), Handle: handle, Next: []State{"a", "c"}})
+	f.Register("c", StateDef{Enter: enter("c"), Handle: handle})
+	return f
+}
+
+func TestFSMAllowed(t *testing.T) {
+	f := testFSM(new([]State))
+	tests := []struct {
+		from, to State
+		want     bool
+	}{
+		{"a", "b", true},
+		{"b", "a", true},
+		{"b", "c", true},
+		{"a", "c", false},
+		{"c", "a", false},
+		{"a", "unknown", false},
+		{"unknown", "a", false},
+	}
+	for _, tt := range tests {
+		if got := f.Allowed(tt.from, tt.to); got != tt.want {
+			t.Errorf("Allowed(%s, %s) = %v, ожидалось %v", tt.from, tt.to, got, tt.want)
+		}
+	}
+}
+
+func TestFSMHandle(t *testing.T) {
+	tb := newTestBot(t)
+	tests := []struct {
+		name    string
+		from    string
+		text    string
+		want    string
+		entered []State
+	}{
+		{"остаться на шаге", "a", "a", "a", nil},
+		{"разрешённый переход", "a", "b", "b", []State{"b"}},
+		{"запрещённый переход", "a", "c", "a", nil},
+		{"переход в неизвестное состояние", "b", "x", "b", nil},
+		{"обработчик сменил шаг", "b", "set:c", "c", nil},
+		{"обработчик сменил шаг запрещённо", "a", "set:c", "a", nil},
+		{"неизвестный шаг сбрасывается", "x", "b", "a", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var entered []State
+			f := testFSM(&entered)
+			us := &entities.UserState{Step: tt.from}
+			f.Handle(tb.bot, tb.ctx, input{chatID: 1, text: tt.text}, us)
+			if us.Step != tt.want {
+				t.Errorf("шаг %q, ожидался %q", us.Step, tt.want)
+			}
+			if len(entered) != len(tt.entered) || (len(entered) > 0 && entered[0] != tt.entered[0]) {
+				t.Errorf("вход в состояния %v, ожидался %v", entered, tt.entered)
+			}
+		})
+	}
+}
+
+func TestFSMTransitionAndJump(t *testing.T) {
+	var entered []State
+	f := testFSM(&entered)
+	us := &entities.UserState{Step: "a"}
+
+	if err := f.Transition(nil, context.Background(), 1, us, "c"); err == nil || us.Step != "a" {
+		t.Fatalf("запрещённый переход: err=%v, шаг %q", err, us.Step)
+	}
+	if err := f.Jump(nil, context.Background(), 1, us, "c"); err != nil || us.Step != "c" {
+		t.Fatalf("Jump: err=%v, шаг %q", err, us.Step)
+	}
+	if err := f.Jump(nil, context.Background(), 1, us, "x"); err == nil || us.Step != "c" {
+		t.Fatalf("Jump в неизвестное состояние: err=%v, шаг %q", err, us.Step)
+	}
+	if len(entered) != 1 || entered[0] != "c" {
+		t.Fatalf("вход в состояния %v", entered)
+	}
+}
+
+func TestFSMDOT(t *testing.T) {
+	f := NewFSM(StateIdle)
+	f.Register(StateIdle, StateDef{Next: []State{"a"}})
+	f.Register("a", StateDef{Next: []State{StateIdle, "b"}})
+	f.Register("b", StateDef{})
+
+	want := "digraph conversation {\n" +
+		"\trankdir=LR;\n" +
+		"\t\"idle\" [shape=doublecircle];\n" +
+		"\t\"idle\" -> \"a\";\n" +
+		"\t\"a\" -> \"idle\";\n" +
+		"\t\"a\" -> \"b\";\n" +
+		"}\n"
+	if got := f.DOT(); got != want {
+		t.Fatalf("DOT:\n%s\nожидалось:\n%s", got, want)
+	}
+}
+
+// Каждый переход диалога ведёт в объявленное состояние.
+func TestConversationTransitionsRegistered(t *testing.T) {
+	for _, s := range conversation.order {
+		for _, next := range conversation.states[s].Next {
+			if !conversation.Allowed(s, next) {
+				t.Errorf("переход %s -> %s ведёт в незарегистрированное состояние", s, next)
+			}
+		}
+	}
+}
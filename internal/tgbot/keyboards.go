@@ -0,0 +1,136 @@
+package tgbot
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"strings"
+
+	"tgbot/internal/entities"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+// Данные кнопки имеют вид "<шаг>|<метка>|<значение>". Шаг и метка
+// привязывают кнопку к моменту диалога, в который она была отправлена:
+// нажатие на кнопку из прошлого шага игнорируется.
+const callbackSeparator = "|"
+
+// stepToken уточняет шаг там, где один шаг повторяется несколько раз,
+// например номер вопроса в тесте.
+func stepToken(us *entities.UserState) string {
+	switch State(us.Step) {
+	case StateTakingTest:
+		return strconv.Itoa(us.TestIndex)
+	case StateCourseField:
+		if us.CourseDraft != nil {
+			return strconv.Itoa(us.CourseDraft.Field)
+		}
+	}
+	return ""
+}
+
+func callbackData(us *entities.UserState, value string) string {
+	return strings.Join([]string{us.Step, stepToken(us), value}, callbackSeparator)
+}
+
+func parseCallbackData(data string) (step, token, value string, ok bool) {
+	parts := strings.SplitN(data, callbackSeparator, 3)
+	if len(parts) != 3 {
+		return "", "", "", false
+	}
+	return parts[0], parts[1], parts[2], true
+}
+
+// choiceButton — кнопка, нажатие на которую равносильно вводу value.
+func choiceButton(us *entities.UserState, label, value string) tgbotapi.InlineKeyboardButton {
+	return tgbotapi.NewInlineKeyboardButtonData(label, callbackData(us, value))
+}
+
+// columnKeyboard располагает кнопки по одной в строке.
+func columnKeyboard(buttons ...tgbotapi.InlineKeyboardButton) tgbotapi.InlineKeyboardMarkup {
+	rows := make([][]tgbotapi.InlineKeyboardButton, 0, len(buttons))
+	for _, button := range buttons {
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(button))
+	}
+	return tgbotapi.NewInlineKeyboardMarkup(rows...)
+}
+
+func (b *Bot) yesNoKeyboard(us *entities.UserState) tgbotapi.InlineKeyboardMarkup {
+	return tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+		b.choiceButton(us, choiceYes),
+		b.choiceButton(us, choiceNo),
+	))
+}
+
+// contactKeyboard — клавиатура под полем ввода с кнопкой, отправляющей
+// номер телефона из профиля Telegram. Кнопки choices отправляют свои подписи
+// текстом, их распознаёт isChoice.
+func (b *Bot) contactKeyboard(us *entities.UserState, choices ...string) tgbotapi.ReplyKeyboardMarkup {
+	rows := [][]tgbotapi.KeyboardButton{tgbotapi.NewKeyboardButtonRow(
+		tgbotapi.NewKeyboardButtonContact(b.choiceLabel(us, "share_contact")),
+	)}
+	for _, choice := range choices {
+		rows = append(rows, tgbotapi.NewKeyboardButtonRow(tgbotapi.NewKeyboardButton(b.choiceLabel(us, choice))))
+	}
+	keyboard := tgbotapi.NewReplyKeyboard(rows...)
+	keyboard.ResizeKeyboard = true
+	keyboard.OneTimeKeyboard = true
+	return keyboard
+}
+
+// chooseCourseKeyboard предлагает перейти к выбору курса из свободного состояния.
+func (b *Bot) chooseCourseKeyboard(us *entities.UserState) tgbotapi.InlineKeyboardMarkup {
+	idle := &entities.UserState{Step: string(StateIdle), Language: us.Language}
+	return columnKeyboard(b.choiceButton(idle, choiceCourse))
+}
+
+// handleCallback обрабатывает нажатие inline-кнопки как ввод на текущем шаге.
+func (b *Bot) handleCallback(ctx context.Context, cq *tgbotapi.CallbackQuery) {
+	if cq.Message == nil || cq.Message.Chat == nil {
+		b.answerCallback(cq.ID, "")
+		return
+	}
+	chatID := cq.Message.Chat.ID
+
+	if payload, ok := strings.CutPrefix(cq.Data, fakePayPrefix); ok {
+		b.handleFakePayment(ctx, cq, payload)
+		return
+	}
+	if payload, ok := strings.CutPrefix(cq.Data, seatOfferPrefix); ok {
+		b.handleSeatOffer(ctx, cq, payload)
+		return
+	}
+	if payload, ok := strings.CutPrefix(cq.Data, languagePrefix); ok {
+		b.handleLanguageButton(ctx, cq, payload)
+		return
+	}
+
+	userState, err := b.states.Get(ctx, chatID)
+	if err != nil {
+		log.Printf("Ошибка при загрузке состояния пользователя: %v", err)
+		b.answerCallback(cq.ID, b.lang(&entities.UserState{}).T("common.try_later"))
+		return
+	}
+	defer b.states.Save(ctx, chatID, userState)
+	b.detectLanguage(ctx, chatID, userState, cq.From)
+
+	step, token, value, ok := parseCallbackData(cq.Data)
+	if !ok || step != userState.Step || token != stepToken(userState) {
+		b.answerCallback(cq.ID, b.lang(userState).T("button.stale"))
+		return
+	}
+	b.answerCallback(cq.ID, "")
+
+	if err := b.store.Conversations.SaveMessage(ctx, chatID, "user", value); err != nil {
+		log.Printf("Ошибка при сохранении входящего сообщения: %v", err)
+	}
+
+	conversation.Handle(b, ctx, input{chatID: chatID, text: value}, userState)
+}
+
+func (b *Bot) answerCallback(callbackID, text string) {
+	if err := b.msgr.AnswerCallback(callbackID, text); err != nil {
+		log.Printf("Ошибка при ответе на нажатие кнопки: %v", err)
+	}
+}
@@ -0,0 +1,156 @@
+package tgbot
+
+import (
+	"context"
+	"log"
+	"strings"
+
+	"tgbot/internal/entities"
+	"tgbot/internal/i18n"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+// Значения кнопок выбора. Они не зависят от языка, а подписи берутся из
+// каталога по ключу "button.<значение>".
+const (
+	choiceYes        = "yes"
+	choiceNo         = "no"
+	choiceCourse     = "choose_course"
+	choiceCancel     = "cancel"
+	choiceSupport    = "support"
+	choiceEndSupport = "end_support"
+	choiceEditName   = "edit_name"
+	choiceEditPhone  = "edit_phone"
+	choiceDone       = "done"
+)
+
+// Кнопка выбора языка в /language. Работает из любого шага диалога.
+const languagePrefix = "lang:"
+
+// lang возвращает переводчик на язык пользователя.
+func (b *Bot) lang(us *entities.UserState) *i18n.Localizer {
+	return b.catalogs.Localizer(us.Language)
+}
+
+// langFor — то же, что lang, для чата, состояние которого не загружено.
+// Если состояние недоступно, используется основной язык.
+func (b *Bot) langFor(ctx context.Context, chatID int64) *i18n.Localizer {
+	us, err := b.states.Get(ctx, chatID)
+	if err != nil {
+		log.Printf("Ошибка при загрузке состояния пользователя: %v", err)
+		return b.lang(&entities.UserState{})
+	}
+	return b.lang(us)
+}
+
+// detectLanguage выбирает язык нового пользователя по language_code из
+// Telegram и сразу сохраняет его, чтобы langFor видел выбор.
+func (b *Bot) detectLanguage(ctx context.Context, chatID int64, us *entities.UserState, from *tgbotapi.User) {
+	if us.Language != "" {
+		return
+	}
+	us.Language = i18n.DefaultLanguage
+	if from != nil {
+		if lang := b.catalogs.Match(from.LanguageCode); lang != "" {
+			us.Language = lang
+		}
+	}
+	b.states.Save(ctx, chatID, us)
+}
+
+// choiceLabel — подпись кнопки выбора на языке пользователя.
+func (b *Bot) choiceLabel(us *entities.UserState, choice string) string {
+	return b.lang(us).T("button." + choice)
+}
+
+func (b *Bot) choiceButton(us *entities.UserState, choice string) tgbotapi.InlineKeyboardButton {
+	return choiceButton(us, b.choiceLabel(us, choice), choice)
+}
+
+// isChoice сообщает, выбрал ли пользователь choice кнопкой или ввёл её подпись.
+func (b *Bot) isChoice(us *entities.UserState, text, choice string) bool {
+	return text == choice || strings.EqualFold(text, b.choiceLabel(us, choice))
+}
+
+// Ключи каталога для уровней курсов. Уровни хранятся в базе по-русски.
+var levelKeys = map[string]string{
+	"Начальный":   "level.beginner",
+	"Средний":     "level.intermediate",
+	"Продвинутый": "level.advanced",
+}
+
+func levelName(l *i18n.Localizer, level string) string {
+	if key, ok := levelKeys[level]; ok {
+		return l.T(key)
+	}
+	return level
+}
+
+// localCourse переводит название и описание курса. У курса из состояния
+// пользователя переводов нет, они берутся из списка курсов.
+func (b *Bot) localCourse(l *i18n.Localizer, course entities.Course) entities.Course {
+	if course.Translations == nil {
+		if cached, ok := b.courseByID(course.ID); ok {
+			course.Translations = cached.Translations
+		}
+	}
+	return course.Localized(l.Language())
+}
+
+// courseName возвращает переведённое название курса или fallback, если
+// курса уже нет в списке.
+func (b *Bot) courseName(l *i18n.Localizer, courseID int64, fallback string) string {
+	if course, ok := b.courseByID(courseID); ok {
+		return course.Localized(l.Language()).Name
+	}
+	return fallback
+}
+
+// sendLanguages обрабатывает /language: без аргумента показывает кнопки
+// языков, с кодом языка («/language en») сразу переключает.
+func (b *Bot) sendLanguages(ctx context.Context, chatID int64, us *entities.UserState, args string) {
+	if args != "" {
+		b.setLanguage(ctx, chatID, us, args)
+		return
+	}
+
+	var buttons []tgbotapi.InlineKeyboardButton
+	for _, lang := range b.catalogs.Languages() {
+		label := b.catalogs.Name(lang)
+		if lang == b.lang(us).Language() {
+			label = "✅ " + label
+		}
+		buttons = append(buttons, tgbotapi.NewInlineKeyboardButtonData(label, languagePrefix+lang))
+	}
+	if _, err := b.msgr.SendKeyboard(chatID, b.lang(us).T("language.choose"), columnKeyboard(buttons...)); err != nil {
+		log.Printf("Ошибка при отправке сообщения в чат %d: %v", chatID, err)
+	}
+}
+
+func (b *Bot) setLanguage(ctx context.Context, chatID int64, us *entities.UserState, code string) {
+	lang := b.catalogs.Match(code)
+	if lang == "" {
+		b.send(chatID, b.lang(us).T("language.unknown", strings.Join(b.catalogs.Languages(), ", ")))
+		return
+	}
+	us.Language = lang
+	b.states.Save(ctx, chatID, us)
+	if us.PhoneNumber != "" {
+		b.saveUser(ctx, chatID, us)
+	}
+	b.send(chatID, b.lang(us).T("language.changed", b.catalogs.Name(lang)))
+}
+
+// handleLanguageButton переключает язык по кнопке из /language.
+func (b *Bot) handleLanguageButton(ctx context.Context, cq *tgbotapi.CallbackQuery, code string) {
+	chatID := cq.Message.Chat.ID
+	userState, err := b.states.Get(ctx, chatID)
+	if err != nil {
+		log.Printf("Ошибка при загрузке состояния пользователя: %v", err)
+		b.answerCallback(cq.ID, b.lang(&entities.UserState{}).T("common.try_later"))
+		return
+	}
+	b.answerCallback(cq.ID, "")
+	b.setLanguage(ctx, chatID, userState, code)
+}
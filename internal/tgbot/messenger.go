@@ -0,0 +1,119 @@
+package tgbot
+
+import (
+	"sync"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+// Messenger описывает всё, что обработчикам нужно от Telegram.
+// Методы отправки возвращают идентификатор отправленного сообщения.
+type Messenger interface {
+	SendText(chatID int64, text string) (int, error)
+	SendKeyboard(chatID int64, text string, keyboard interface{}) (int, error)
+	AnswerCallback(callbackID, text string) error
+}
+
+// TelegramMessenger отправляет сообщения через Bot API.
+type TelegramMessenger struct {
+	api *tgbotapi.BotAPI
+}
+
+func NewTelegramMessenger(api *tgbotapi.BotAPI) *TelegramMessenger {
+	return &TelegramMessenger{api: api}
+}
+
+func (m *TelegramMessenger) SendText(chatID int64, text string) (int, error) {
+	sent, err := m.api.Send(tgbotapi.NewMessage(chatID, text))
+	return sent.MessageID, err
+}
+
+func (m *TelegramMessenger) SendKeyboard(chatID int64, text string, keyboard interface{}) (int, error) {
+	msg := tgbotapi.NewMessage(chatID, text)
+	msg.ReplyMarkup = keyboard
+	sent, err := m.api.Send(msg)
+	return sent.MessageID, err
+}
+
+func (m *TelegramMessenger) AnswerCallback(callbackID, text string) error {
+	_, err := m.api.AnswerCallbackQuery(tgbotapi.NewCallback(callbackID, text))
+	return err
+}
+
+// SentMessage — сообщение, перехваченное RecordingMessenger.
+type SentMessage struct {
+	MessageID int
+	ChatID    int64
+	Text      string
+	Keyboard  interface{}
+}
+
+// AnsweredCallback — ответ на нажатие кнопки, перехваченный RecordingMessenger.
+type AnsweredCallback struct {
+	CallbackID string
+	Text       string
+}
+
+// RecordingMessenger ничего не отправляет, а запоминает все сообщения в памяти.
+// Используется в тестах, чтобы прогонять сценарии диалога без токена бота.
+type RecordingMessenger struct {
+	mu        sync.Mutex
+	nextID    int
+	sent      []SentMessage
+	callbacks []AnsweredCallback
+}
+
+func NewRecordingMessenger() *RecordingMessenger {
+	return &RecordingMessenger{}
+}
+
+func (m *RecordingMessenger) SendText(chatID int64, text string) (int, error) {
+	return m.record(chatID, text, nil), nil
+}
+
+func (m *RecordingMessenger) SendKeyboard(chatID int64, text string, keyboard interface{}) (int, error) {
+	return m.record(chatID, text, keyboard), nil
+}
+
+func (m *RecordingMessenger) AnswerCallback(callbackID, text string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.callbacks = append(m.callbacks, AnsweredCallback{CallbackID: callbackID, Text: text})
+	return nil
+}
+
+func (m *RecordingMessenger) record(chatID int64, text string, keyboard interface{}) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.nextID++
+	m.sent = append(m.sent, SentMessage{MessageID: m.nextID, ChatID: chatID, Text: text, Keyboard: keyboard})
+	return m.nextID
+}
+
+// Sent возвращает все сообщения, отправленные в чат chatID, в порядке отправки.
+func (m *RecordingMessenger) Sent(chatID int64) []SentMessage {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var result []SentMessage
+	for _, msg := range m.sent {
+		if msg.ChatID == chatID {
+			result = append(result, msg)
+		}
+	}
+	return result
+}
+
+// Callbacks возвращает все ответы на нажатия кнопок.
+func (m *RecordingMessenger) Callbacks() []AnsweredCallback {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]AnsweredCallback(nil), m.callbacks...)
+}
+
+// Reset забывает все перехваченные сообщения.
+func (m *RecordingMessenger) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sent = nil
+	m.callbacks = nil
+}
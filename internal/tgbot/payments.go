@@ -0,0 +1,344 @@
+package tgbot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+
+	"tgbot/internal/entities"
+	"tgbot/internal/i18n"
+	"tgbot/internal/storage"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+// Валюта счетов. Цены курсов хранятся в рублях.
+const invoiceCurrency = "RUB"
+
+// Invoice — счёт на оплату одной записи на курс.
+type Invoice struct {
+	EnrollmentID int64
+	Title        string
+	Description  string
+	Amount       int // в копейках, как требует Telegram
+	Currency     string
+}
+
+// Payload связывает счёт с записью: Telegram возвращает его в PreCheckoutQuery
+// и SuccessfulPayment.
+func (inv Invoice) Payload() string {
+	return "enrollment:" + strconv.FormatInt(inv.EnrollmentID, 10)
+}
+
+func parseInvoicePayload(payload string) (int64, bool) {
+	raw, ok := strings.CutPrefix(payload, "enrollment:")
+	if !ok {
+		return 0, false
+	}
+	id, err := strconv.ParseInt(raw, 10, 64)
+	return id, err == nil
+}
+
+// Ограничения Telegram на длину заголовка и описания счёта, в символах.
+const (
+	invoiceTitleLimit       = 32
+	invoiceDescriptionLimit = 255
+)
+
+// newInvoice выставляет счёт за курс. Длинное название обрезается в
+// заголовке, полностью оно остаётся в описании.
+func newInvoice(l *i18n.Localizer, enrollmentID int64, course entities.Course) Invoice {
+	return Invoice{
+		EnrollmentID: enrollmentID,
+		Title:        truncate(course.Name, invoiceTitleLimit),
+		Description:  truncate(l.T("payment.invoice_description", course.Name, course.Teacher), invoiceDescriptionLimit),
+		Amount:       priceAmount(course.Price),
+		Currency:     invoiceCurrency,
+	}
+}
+
+// truncate обрезает s до limit символов, заменяя конец многоточием.
+// Считаются руны, а не байты, чтобы не разрезать кириллицу посередине.
+func truncate(s string, limit int) string {
+	runes := []rune(s)
+	if len(runes) <= limit {
+		return s
+	}
+	return string(runes[:limit-1]) + "…"
+}
+
+// priceAmount переводит цену в рублях в копейки.
+func priceAmount(price float64) int {
+	return int(math.Round(price * 100))
+}
+
+// PaymentProvider выставляет счета и отвечает на запросы перед списанием.
+type PaymentProvider interface {
+	SendInvoice(chatID int64, inv Invoice) error
+	AnswerPreCheckout(queryID string, ok bool, errorMessage string) error
+}
+
+// TelegramPayments выставляет счета через Telegram Payments с токеном
+// платёжного провайдера из BotFather.
+type TelegramPayments struct {
+	api           *tgbotapi.BotAPI
+	providerToken string
+}
+
+func NewTelegramPayments(api *tgbotapi.BotAPI, providerToken string) *TelegramPayments {
+	return &TelegramPayments{api: api, providerToken: providerToken}
+}
+
+func (p *TelegramPayments) SendInvoice(chatID int64, inv Invoice) error {
+	prices := []tgbotapi.LabeledPrice{{Label: inv.Title, Amount: inv.Amount}}
+	cfg := tgbotapi.NewInvoice(chatID, inv.Title, inv.Description, inv.Payload(), p.providerToken, "course", inv.Currency, &prices)
+	_, err := p.api.Send(cfg)
+	return err
+}
+
+func (p *TelegramPayments) AnswerPreCheckout(queryID string, ok bool, errorMessage string) error {
+	_, err := p.api.AnswerPreCheckoutQuery(tgbotapi.PreCheckoutConfig{
+		PreCheckoutQueryID: queryID,
+		OK:                 ok,
+		ErrorMessage:       errorMessage,
+	})
+	return err
+}
+
+// Кнопка фейкового счёта. Нажатие на неё бот принимает как успешную оплату,
+// но только если запущен с FakePaymentProvider.
+const fakePayPrefix = "fakepay:"
+
+// FakePaymentProvider ничего не списывает: вместо счёта отправляет сообщение
+// с кнопкой «Оплатить». Используется в тестах и при локальном запуске без
+// токена провайдера.
+type FakePaymentProvider struct {
+	msgr Messenger
+
+	mu       sync.Mutex
+	invoices []Invoice
+}
+
+func NewFakePaymentProvider(msgr Messenger) *FakePaymentProvider {
+	return &FakePaymentProvider{msgr: msgr}
+}
+
+func (p *FakePaymentProvider) SendInvoice(chatID int64, inv Invoice) error {
+	p.mu.Lock()
+	p.invoices = append(p.invoices, inv)
+	p.mu.Unlock()
+
+	text := fmt.Sprintf("🧾 Тестовый счёт: %s\n%s\nК оплате: %.2f %s", inv.Title, inv.Description, float64(inv.Amount)/100, inv.Currency)
+	keyboard := columnKeyboard(tgbotapi.NewInlineKeyboardButtonData("Оплатить (тест)", fakePayPrefix+inv.Payload()))
+	_, err := p.msgr.SendKeyboard(chatID, text, keyboard)
+	return err
+}
+
+func (p *FakePaymentProvider) AnswerPreCheckout(queryID string, ok bool, errorMessage string) error {
+	return nil
+}
+
+func (p *FakePaymentProvider) invoice(enrollmentID int64) (Invoice, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, inv := range p.invoices {
+		if inv.EnrollmentID == enrollmentID {
+			return inv, true
+		}
+	}
+	return Invoice{}, false
+}
+
+// Invoices возвращает все выставленные счета.
+func (p *FakePaymentProvider) Invoices() []Invoice {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]Invoice(nil), p.invoices...)
+}
+
+// sendInvoice создаёт неоплаченную запись на выбранный курс и выставляет
+// по ней счёт. Оплаченной запись становится только после SuccessfulPayment.
+func (b *Bot) sendInvoice(ctx context.Context, chatID int64, us *entities.UserState) bool {
+	l := b.lang(us)
+	enrollmentID, err := b.store.Enrollments.SaveEnrollment(ctx, chatID, us.Selected.ID, false, us.TestScore)
+	if err != nil {
+		log.Printf("Ошибка при сохранении записи на курс: %v", err)
+		b.reply(ctx, chatID, l.T("payment.enroll_error"))
+		return false
+	}
+
+	if err := b.payments.SendInvoice(chatID, newInvoice(l, enrollmentID, b.localCourse(l, *us.Selected))); err != nil {
+		log.Printf("Ошибка при отправке счёта по записи %d: %v", enrollmentID, err)
+		b.reply(ctx, chatID, l.T("payment.invoice_error"))
+		return false
+	}
+	return true
+}
+
+// checkPayable проверяет, что по записи можно принять платёж на сумму amount.
+// Возвращает ключ сообщения об ошибке для пользователя или пустую строку.
+func (b *Bot) checkPayable(ctx context.Context, enrollmentID int64, amount int, currency string) string {
+	enrollment, err := b.store.Enrollments.GetEnrollment(ctx, enrollmentID)
+	if err != nil {
+		log.Printf("Ошибка при получении записи %d: %v", enrollmentID, err)
+		return "payment.check_error"
+	}
+	if enrollment == nil {
+		return "payment.enrollment_not_found"
+	}
+	if enrollment.IsPaid {
+		return "payment.already_paid"
+	}
+	if enrollment.Canceled {
+		return "payment.enrollment_canceled"
+	}
+
+	course, ok := b.courseByID(enrollment.CourseID)
+	if !ok {
+		return "course.unavailable"
+	}
+	if currency != invoiceCurrency || amount != priceAmount(course.Price) {
+		return "payment.price_changed"
+	}
+	available, err := b.seatAvailable(ctx, enrollment.UserID, course)
+	if err != nil {
+		log.Printf("Ошибка при подсчёте мест на курсе %d: %v", course.ID, err)
+		return "course.seats_error"
+	}
+	if !available {
+		return "payment.no_seats"
+	}
+	return ""
+}
+
+// handlePreCheckout подтверждает или отклоняет списание. Telegram ждёт ответ
+// не дольше 10 секунд, поэтому проверяется только сама запись.
+func (b *Bot) handlePreCheckout(ctx context.Context, q *tgbotapi.PreCheckoutQuery) {
+	errorKey := "payment.unknown_invoice"
+	if enrollmentID, ok := parseInvoicePayload(q.InvoicePayload); ok {
+		errorKey = b.checkPayable(ctx, enrollmentID, q.TotalAmount, q.Currency)
+	}
+
+	var errorMessage string
+	if errorKey != "" {
+		log.Printf("Отклонён платёж %s: %s", q.InvoicePayload, errorKey)
+		l := b.catalogs.Localizer(i18n.DefaultLanguage)
+		if q.From != nil {
+			// Личный чат плательщика совпадает с его id
+			l = b.langFor(ctx, int64(q.From.ID))
+		}
+		errorMessage = l.T(errorKey)
+	}
+	if err := b.payments.AnswerPreCheckout(q.ID, errorMessage == "", errorMessage); err != nil {
+		log.Printf("Ошибка при ответе на pre_checkout_query: %v", err)
+	}
+}
+
+// handleSuccessfulPayment отмечает запись оплаченной и продолжает диалог.
+func (b *Bot) handleSuccessfulPayment(ctx context.Context, chatID int64, payment *tgbotapi.SuccessfulPayment) {
+	userState, err := b.states.Get(ctx, chatID)
+	if err != nil {
+		// Оплату всё равно нужно отметить, а вот сохранять незагруженное
+		// состояние нельзя: диалог просто не продолжится
+		log.Printf("Ошибка при загрузке состояния пользователя: %v", err)
+		userState = &entities.UserState{}
+	} else {
+		defer b.states.Save(ctx, chatID, userState)
+	}
+
+	enrollmentID, ok := parseInvoicePayload(payment.InvoicePayload)
+	if !ok {
+		log.Printf("Платёж с неизвестным payload %q в чате %d", payment.InvoicePayload, chatID)
+		return
+	}
+	err = b.store.Enrollments.MarkEnrollmentPaid(ctx, enrollmentID, payment.TelegramPaymentChargeID, payment.ProviderPaymentChargeID, b.jobs.Now())
+	if errors.Is(err, storage.ErrNotPayable) {
+		b.handleUnpayableEnrollment(ctx, chatID, enrollmentID, payment, userState, err)
+		return
+	}
+	if err != nil {
+		// Деньги уже списаны: запись нужно отметить вручную по идентификаторам из лога
+		log.Printf("ОПЛАТА НЕ ЗАПИСАНА: запись %d, чат %d, telegram charge %s, provider charge %s, сумма %d %s: %v",
+			enrollmentID, chatID, payment.TelegramPaymentChargeID, payment.ProviderPaymentChargeID, payment.TotalAmount, payment.Currency, err)
+		b.reply(ctx, chatID, b.lang(userState).T("payment.mark_error"))
+		return
+	}
+	if enrollment, err := b.store.Enrollments.GetEnrollment(ctx, enrollmentID); err == nil && enrollment != nil {
+		b.cancelPaymentReminder(ctx, chatID, enrollment.CourseID)
+		b.completeSeatOffer(ctx, enrollment.UserID, enrollment.CourseID)
+	}
+
+	b.reply(ctx, chatID, b.lang(userState).T("payment.success"))
+	if State(userState.Step) == StateWaitingForInvoice {
+		if err := conversation.Transition(b, ctx, chatID, userState, StateWaitingForQuestionsAsk); err != nil {
+			log.Printf("Ошибка перехода после оплаты: %v", err)
+		}
+	}
+}
+
+// handleUnpayableEnrollment отвечает на платёж за запись, которую уже нельзя
+// оплатить: пока пользователь платил, последнее место занял другой или запись
+// отменили. Деньги менеджер возвращает по идентификаторам из лога. Если не
+// хватило места, запись отменяется, а пользователю предлагается встать в лист
+// ожидания.
+func (b *Bot) handleUnpayableEnrollment(ctx context.Context, chatID, enrollmentID int64, payment *tgbotapi.SuccessfulPayment, us *entities.UserState, reason error) {
+	log.Printf("ВЕРНУТЬ ОПЛАТУ: %v, запись %d, чат %d, telegram charge %s, provider charge %s, сумма %d %s",
+		reason, enrollmentID, chatID, payment.TelegramPaymentChargeID, payment.ProviderPaymentChargeID, payment.TotalAmount, payment.Currency)
+	if errors.Is(reason, storage.ErrEnrollmentCanceled) {
+		b.reply(ctx, chatID, b.lang(us).T("payment.refund_canceled"))
+		return
+	}
+	b.reply(ctx, chatID, b.lang(us).T("payment.refund_no_seats"))
+
+	enrollment, err := b.store.Enrollments.GetEnrollment(ctx, enrollmentID)
+	if err != nil || enrollment == nil {
+		log.Printf("Ошибка при получении записи %d: %v", enrollmentID, err)
+		return
+	}
+	if err := b.store.Enrollments.CancelEnrollment(ctx, enrollmentID); err != nil {
+		log.Printf("Ошибка при отмене записи %d: %v", enrollmentID, err)
+	}
+	b.cancelPaymentReminder(ctx, chatID, enrollment.CourseID)
+
+	if State(us.Step) == StateWaitingForInvoice && us.Selected != nil && us.Selected.ID == enrollment.CourseID {
+		if err := conversation.Transition(b, ctx, chatID, us, StateWaitlistAsk); err != nil {
+			log.Printf("Ошибка перехода к листу ожидания: %v", err)
+		}
+	}
+}
+
+// handleFakePayment принимает нажатие кнопки фейкового счёта за оплату,
+// проходя те же проверки, что и настоящий pre_checkout_query.
+func (b *Bot) handleFakePayment(ctx context.Context, cq *tgbotapi.CallbackQuery, payload string) {
+	l := b.langFor(ctx, cq.Message.Chat.ID)
+	fake, ok := b.payments.(*FakePaymentProvider)
+	if !ok {
+		b.answerCallback(cq.ID, l.T("button.stale"))
+		return
+	}
+
+	enrollmentID, _ := parseInvoicePayload(payload)
+	inv, ok := fake.invoice(enrollmentID)
+	if !ok {
+		b.answerCallback(cq.ID, l.T("payment.invoice_not_found"))
+		return
+	}
+	if errorKey := b.checkPayable(ctx, enrollmentID, inv.Amount, inv.Currency); errorKey != "" {
+		b.answerCallback(cq.ID, l.T(errorKey))
+		return
+	}
+	b.answerCallback(cq.ID, "")
+
+	b.handleSuccessfulPayment(ctx, cq.Message.Chat.ID, &tgbotapi.SuccessfulPayment{
+		Currency:                inv.Currency,
+		TotalAmount:             inv.Amount,
+		InvoicePayload:          payload,
+		TelegramPaymentChargeID: fmt.Sprintf("fake-telegram-%d", enrollmentID),
+		ProviderPaymentChargeID: fmt.Sprintf("fake-provider-%d", enrollmentID),
+	})
+}
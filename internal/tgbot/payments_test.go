@@ -0,0 +1,67 @@
+package tgbot
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"tgbot/internal/entities"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+func TestPaymentForCanceledEnrollment(t *testing.T) {
+	tb := newTestBot(t)
+	l := tb.bot.catalogs.Localizer("ru")
+	const chatID = 42
+
+	enrollmentID, err := tb.store.Enrollments.SaveEnrollment(tb.ctx, chatID, 1, false, 0)
+	if err != nil {
+		t.Fatalf("SaveEnrollment: %v", err)
+	}
+	if err := tb.store.Enrollments.CancelEnrollment(tb.ctx, enrollmentID); err != nil {
+		t.Fatalf("CancelEnrollment: %v", err)
+	}
+
+	// Платёж пришёл уже после отмены: запись остаётся неоплаченной,
+	// пользователю обещают вернуть деньги
+	tb.bot.handleSuccessfulPayment(tb.ctx, chatID, &tgbotapi.SuccessfulPayment{
+		Currency:                invoiceCurrency,
+		TotalAmount:             100,
+		InvoicePayload:          Invoice{EnrollmentID: enrollmentID}.Payload(),
+		TelegramPaymentChargeID: "tg-charge",
+		ProviderPaymentChargeID: "provider-charge",
+	})
+	tb.expect(chatID, l.T("payment.refund_canceled"))
+	enrollment, err := tb.store.Enrollments.GetEnrollment(tb.ctx, enrollmentID)
+	if err != nil || enrollment == nil || enrollment.IsPaid || !enrollment.Canceled {
+		t.Fatalf("запись после платежа: %+v, %v", enrollment, err)
+	}
+}
+
+func TestNewInvoiceLimits(t *testing.T) {
+	tb := newTestBot(t)
+	l := tb.bot.catalogs.Localizer("ru")
+
+	course := entities.Course{Name: "Go для начинающих", Teacher: "Анна", Price: 1500.5}
+	inv := newInvoice(l, 7, course)
+	if inv.Title != course.Name || inv.Description != l.T("payment.invoice_description", course.Name, course.Teacher) || inv.Amount != 150050 {
+		t.Fatalf("счёт: %+v", inv)
+	}
+
+	// Заголовок не длиннее 32 символов, но полное название есть в описании
+	course.Name = "Промышленная разработка на Go: микросервисы, очереди и наблюдаемость"
+	inv = newInvoice(l, 7, course)
+	if n := utf8.RuneCountInString(inv.Title); n != invoiceTitleLimit || !utf8.ValidString(inv.Title) || !strings.HasSuffix(inv.Title, "…") {
+		t.Fatalf("заголовок %q из %d символов", inv.Title, n)
+	}
+	if !strings.HasPrefix(course.Name, strings.TrimSuffix(inv.Title, "…")) || !strings.Contains(inv.Description, course.Name) {
+		t.Fatalf("счёт: %+v", inv)
+	}
+
+	course.Teacher = strings.Repeat("Преподаватель ", 30)
+	inv = newInvoice(l, 7, course)
+	if n := utf8.RuneCountInString(inv.Description); n != invoiceDescriptionLimit || !utf8.ValidString(inv.Description) {
+		t.Fatalf("описание из %d символов", n)
+	}
+}
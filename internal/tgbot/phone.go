@@ -0,0 +1,66 @@
+package tgbot
+
+import (
+	"errors"
+	"strings"
+)
+
+var errInvalidPhone = errors.New("invalid phone number")
+
+// normalizePhone приводит номер к формату E.164 (+79991234567).
+//
+// Номера России и Казахстана (код +7) принимаются в привычных записях:
+// +7 999 123-45-67, 8 (999) 123-45-67, 79991234567, 9991234567. Номера
+// других стран принимаются только с «+» и кодом страны.
+func normalizePhone(raw string) (string, error) {
+	raw = strings.TrimSpace(raw)
+	international := strings.HasPrefix(raw, "+")
+	if international {
+		raw = raw[1:]
+	}
+
+	var digits strings.Builder
+	for _, r := range raw {
+		switch {
+		case r >= '0' && r <= '9':
+			digits.WriteRune(r)
+		case r == ' ' || r == '-' || r == '(' || r == ')' || r == '.' || r == '\u00a0':
+		default:
+			return "", errInvalidPhone
+		}
+	}
+	number := digits.String()
+
+	switch {
+	case len(number) == 10 && !international:
+		// Без кода страны: 999 123-45-67
+		number = "7" + number
+	case len(number) == 11 && number[0] == '8' && !international:
+		// Внутренний формат: 8 999 123-45-67
+		number = "7" + number[1:]
+	}
+
+	if strings.HasPrefix(number, "7") {
+		if len(number) != 11 || !validRuKzNumber(number[1:]) {
+			return "", errInvalidPhone
+		}
+		return "+" + number, nil
+	}
+
+	// Код страны не начинается с нуля, а номер E.164 — не длиннее 15 цифр
+	if !international || len(number) < 8 || len(number) > 15 || number[0] == '0' {
+		return "", errInvalidPhone
+	}
+	return "+" + number, nil
+}
+
+// validRuKzNumber проверяет десятизначный номер после +7. У России
+// коды начинаются с 3, 4, 8 (городские) и 9 (мобильные), у Казахстана —
+// с 6 и 7.
+func validRuKzNumber(national string) bool {
+	switch national[0] {
+	case '3', '4', '6', '7', '8', '9':
+		return true
+	}
+	return false
+}
@@ -0,0 +1,82 @@
+package tgbot
+
+import (
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+func TestNormalizePhone(t *testing.T) {
+	valid := []struct{ in, want string }{
+		{"+7 999 123-45-67", "+79991234567"},
+		{"8 (999) 123-45-67", "+79991234567"},
+		{"79991234567", "+79991234567"},
+		{"9991234567", "+79991234567"},
+		{" +7 (701) 123 45 67 ", "+77011234567"}, // Казахстан, мобильный
+		{"87172123456", "+77172123456"},          // Казахстан, городской
+		{"8 495 123.45.67", "+74951234567"},
+		{"+7 812 123 4567", "+78121234567"},
+		{"+44 20 7946 0958", "+442079460958"},
+		{"+1 (212) 555-0100", "+12125550100"},
+		{"+12345678", "+12345678"},               // минимум 8 цифр
+		{"+123456789012345", "+123456789012345"}, // максимум 15 цифр
+	}
+	for _, tt := range valid {
+		got, err := normalizePhone(tt.in)
+		if err != nil || got != tt.want {
+			t.Errorf("normalizePhone(%q) = %q, %v, ожидалось %q", tt.in, got, err, tt.want)
+		}
+	}
+
+	invalid := []string{
+		"",
+		"abc",
+		"+7 999 123-45-6",   // короткий
+		"+7 999 123-45-678", // длинный
+		"+7 199 123-45-67",  // после +7 код не бывает на 1, 0 и 5
+		"+7 099 123-45-67",
+		"+7 599 123-45-67",
+		"8 599 123-45-67", // 8 заменяется на +7 и проверяется так же
+		"5991234567",
+		"442079460958", // другие страны — только с «+»
+		"+1234567",     // короче 8 цифр
+		"+1234567890123456",
+		"+0 123 456 789", // код страны не начинается с нуля
+		"+7 999 123-45-67 доб. 1",
+		"++79991234567",
+		"+7 999 123_45_67",
+	}
+	for _, in := range invalid {
+		if got, err := normalizePhone(in); err == nil {
+			t.Errorf("normalizePhone(%q) = %q, ожидалась ошибка", in, got)
+		}
+	}
+}
+
+func TestSharedContactPhone(t *testing.T) {
+	tb := newTestBot(t)
+	l := tb.bot.catalogs.Localizer("ru")
+	const chatID = 42
+	shareContact := func(userID int, phone string) {
+		tb.msgr.Reset()
+		tb.handle(tgbotapi.Update{Message: &tgbotapi.Message{
+			Chat:    &tgbotapi.Chat{ID: chatID},
+			From:    tb.user(chatID),
+			Contact: &tgbotapi.Contact{PhoneNumber: phone, UserID: userID},
+		}})
+	}
+
+	tb.say(chatID, "/start")
+	tb.say(chatID, "Иван")
+
+	// Чужой контакт не принимается, даже с верным номером
+	shareContact(chatID+1, "+77011234567")
+	tb.expect(chatID, l.T("onboarding.phone_foreign_contact"))
+
+	// Telegram присылает номер своего контакта без «+»
+	shareContact(chatID, "77011234567")
+	tb.expect(chatID, l.T("onboarding.phone_saved", "+77011234567"), l.T("onboarding.track"))
+	if phone := tb.state(chatID).PhoneNumber; phone != "+77011234567" {
+		t.Fatalf("сохранён телефон %q", phone)
+	}
+}
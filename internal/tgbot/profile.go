@@ -0,0 +1,157 @@
+package tgbot
+
+import (
+	"context"
+	"log"
+	"strings"
+
+	"tgbot/internal/entities"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+// Профиль пользователя хранится в users отдельно от состояния диалога:
+// по нему бот узнаёт вернувшегося пользователя, а /profile позволяет
+// изменить имя и телефон.
+const (
+	StateProfile      State = "profile"
+	StateProfileName  State = "profile_name"
+	StateProfilePhone State = "profile_phone"
+)
+
+func registerProfile(f *FSM) {
+	f.Register(StateProfile, StateDef{
+		Enter:  (*Bot).enterProfile,
+		Handle: (*Bot).handleProfile,
+		Next:   []State{StateProfileName, StateProfilePhone, StateIdle},
+	})
+	f.Register(StateProfileName, StateDef{
+		Enter:  (*Bot).enterProfileName,
+		Handle: (*Bot).handleProfileName,
+		Next:   []State{StateProfile},
+	})
+	f.Register(StateProfilePhone, StateDef{
+		Enter:  (*Bot).enterProfilePhone,
+		Handle: (*Bot).handleProfilePhone,
+		Next:   []State{StateProfile},
+	})
+}
+
+// recognizeUser восстанавливает профиль вернувшегося пользователя, если
+// состояние диалога потеряно, чтобы он не проходил знакомство и тест заново.
+// Знакомым пользователям обновляет время последнего визита. После /restart
+// шаг уже не свободный, и знакомство проходит заново.
+func (b *Bot) recognizeUser(ctx context.Context, chatID int64, us *entities.UserState) {
+	fresh := us.Name == "" && State(us.Step) == StateIdle
+	if !fresh {
+		if err := b.store.Users.TouchUser(ctx, chatID, b.jobs.Now()); err != nil {
+			log.Printf("Ошибка при обновлении профиля пользователя %d: %v", chatID, err)
+		}
+		return
+	}
+
+	user, err := b.store.Users.GetUser(ctx, chatID)
+	if err != nil {
+		log.Printf("Ошибка при загрузке профиля пользователя %d: %v", chatID, err)
+		return
+	}
+	if user == nil {
+		return
+	}
+	us.Name = user.Name
+	us.PhoneNumber = user.PhoneNumber
+	if user.Language != "" {
+		us.Language = user.Language
+	}
+	if err := b.store.Users.TouchUser(ctx, chatID, b.jobs.Now()); err != nil {
+		log.Printf("Ошибка при обновлении профиля пользователя %d: %v", chatID, err)
+	}
+	b.reply(ctx, chatID, b.lang(us).T("profile.welcome_back", us.Name))
+}
+
+// saveUser переносит имя, телефон и язык из состояния диалога в профиль.
+func (b *Bot) saveUser(ctx context.Context, chatID int64, us *entities.UserState) {
+	user := entities.User{
+		TelegramID:  chatID,
+		Name:        us.Name,
+		PhoneNumber: us.PhoneNumber,
+		Language:    us.Language,
+		LastSeenAt:  b.jobs.Now(),
+	}
+	if err := b.store.Users.SaveUser(ctx, user); err != nil {
+		log.Printf("Ошибка при сохранении профиля пользователя %d: %v", chatID, err)
+	}
+}
+
+func (b *Bot) startProfile(ctx context.Context, chatID int64, us *entities.UserState) {
+	if err := conversation.Jump(b, ctx, chatID, us, StateProfile); err != nil {
+		log.Printf("Ошибка при открытии профиля: %v", err)
+	}
+}
+
+func (b *Bot) enterProfile(ctx context.Context, chatID int64, us *entities.UserState) {
+	l := b.lang(us)
+	text := l.T("profile.card", us.Name, us.PhoneNumber, b.catalogs.Name(l.Language()))
+	b.replyKeyboard(ctx, chatID, text, columnKeyboard(
+		b.choiceButton(us, choiceEditName),
+		b.choiceButton(us, choiceEditPhone),
+		b.choiceButton(us, choiceDone),
+	))
+}
+
+func (b *Bot) handleProfile(ctx context.Context, in input, us *entities.UserState) State {
+	l := b.lang(us)
+	switch {
+	case b.isChoice(us, in.text, choiceEditName):
+		return StateProfileName
+	case b.isChoice(us, in.text, choiceEditPhone):
+		return StateProfilePhone
+	case b.isChoice(us, in.text, choiceDone):
+		b.replyKeyboard(ctx, in.chatID, l.T("profile.closed"), b.chooseCourseKeyboard(us))
+		return StateIdle
+	}
+	b.reply(ctx, in.chatID, l.T("profile.pick_action"))
+	return StateProfile
+}
+
+func (b *Bot) enterProfileName(ctx context.Context, chatID int64, us *entities.UserState) {
+	b.replyKeyboard(ctx, chatID, b.lang(us).T("profile.name_prompt"), columnKeyboard(b.choiceButton(us, choiceCancel)))
+}
+
+func (b *Bot) handleProfileName(ctx context.Context, in input, us *entities.UserState) State {
+	l := b.lang(us)
+	if b.isChoice(us, in.text, choiceCancel) {
+		return StateProfile
+	}
+	name := strings.TrimSpace(in.text)
+	if name == "" {
+		b.reply(ctx, in.chatID, l.T("admin.empty_value"))
+		return StateProfileName
+	}
+
+	us.Name = name
+	b.saveUser(ctx, in.chatID, us)
+	b.reply(ctx, in.chatID, l.T("profile.name_saved", name))
+	return StateProfile
+}
+
+func (b *Bot) enterProfilePhone(ctx context.Context, chatID int64, us *entities.UserState) {
+	b.replyKeyboard(ctx, chatID, b.lang(us).T("profile.phone_prompt"), b.contactKeyboard(us, choiceCancel))
+}
+
+func (b *Bot) handleProfilePhone(ctx context.Context, in input, us *entities.UserState) State {
+	l := b.lang(us)
+	if in.contact == nil && b.isChoice(us, in.text, choiceCancel) {
+		b.replyKeyboard(ctx, in.chatID, l.T("profile.phone_unchanged"), tgbotapi.NewRemoveKeyboard(false))
+		return StateProfile
+	}
+	phone, ok := b.readPhone(ctx, in, us, b.contactKeyboard(us, choiceCancel))
+	if !ok {
+		return StateProfilePhone
+	}
+
+	us.PhoneNumber = phone
+	b.saveUser(ctx, in.chatID, us)
+	b.replyKeyboard(ctx, in.chatID, l.T("onboarding.phone_saved", phone), tgbotapi.NewRemoveKeyboard(false))
+	return StateProfile
+}
@@ -1,54 +1,127 @@
 package tgbot
 
-var testQuestions = []TestQuestion{
-	{
-		Question: "Что такое переменная в программировании?",
-		Options:  []string{"Константа", "Указатель", "Область памяти с именем", "Цикл"},
-		Answer:   2,
-	},
-	{
-		Question: "Какой тип данных используется для целых чисел в Go?",
-		Options:  []string{"float", "string", "bool", "int"},
-		Answer:   3,
-	},
-	{
-		Question: "Какой символ используется для начала комментария в Go?",
-		Options:  []string{"//", "#", "--", "/*"},
-		Answer:   0,
-	},
-	{
-		Question: "Как объявить функцию в Go?",
-		Options:  []string{"def", "function", "func", "fn"},
-		Answer:   2,
-	},
-	{
-		Question: "Какой ключ используется для условного оператора?",
-		Options:  []string{"case", "for", "switch", "if"},
-		Answer:   3,
-	},
-	{
-		Question: "Как создать срез в Go?",
-		Options:  []string{"array()", "[]", "slice{}", "{}"},
-		Answer:   1,
-	},
-	{
-		Question: "Что такое goroutine?",
-		Options:  []string{"Тип данных", "Функция", "Отдельный поток выполнения", "Модуль"},
-		Answer:   2,
-	},
-	{
-		Question: "Как обозначается цикл с 5 итерациями?",
-		Options:  []string{"repeat 5", "for i := 0; i < 5; i++", "loop 5", "foreach 5"},
-		Answer:   1,
-	},
-	{
-		Question: "Какой оператор используется для присваивания?",
-		Options:  []string{"==", "->", "=", ":="},
-		Answer:   2,
-	},
-	{
-		Question: "Как обозначается пакет в начале файла Go?",
-		Options:  []string{"import", "package", "main", "module"},
-		Answer:   1,
-	},
+import (
+	"context"
+	"log"
+	"strconv"
+	"strings"
+
+	"tgbot/internal/entities"
+)
+
+// Ключи каталога для статусов вопросов.
+var questionStatusKeys = map[string]string{
+	entities.QuestionOpen:     "questions.status_open",
+	entities.QuestionAnswered: "questions.status_answered",
+	entities.QuestionClosed:   "questions.status_closed",
+}
+
+// sendUserQuestions показывает вопросы пользователей. args — необязательный
+// фильтр по статусу: open, answered или closed.
+func (b *Bot) sendUserQuestions(ctx context.Context, chatID int64, args string) {
+	l := b.langFor(ctx, chatID)
+	status := strings.ToLower(args)
+	if _, ok := questionStatusKeys[status]; status != "" && !ok {
+		b.send(chatID, l.T("questions.filter_usage"))
+		return
+	}
+
+	questions, err := b.store.Questions.GetUserQuestions(ctx, status)
+	if err != nil {
+		log.Printf("Ошибка при получении вопросов пользователей: %v", err)
+		b.send(chatID, l.T("questions.list_error"))
+		return
+	}
+
+	if len(questions) == 0 {
+		if status == entities.QuestionOpen {
+			b.send(chatID, l.T("questions.no_open"))
+			return
+		}
+		b.send(chatID, l.T("questions.list_empty"))
+		return
+	}
+
+	var sb strings.Builder
+	sb.WriteString(l.T("questions.list_header"))
+	for _, q := range questions {
+		sb.WriteString(l.T("questions.item", q.ID, l.T(questionStatusKeys[q.Status]), q.Name, q.PhoneNumber, q.QuestionText, q.Timestamp))
+		if q.Answer != "" {
+			sb.WriteString(l.T("questions.item_answer", q.Answer, q.AnsweredAt))
+		}
+		sb.WriteString("\n")
+	}
+	if status == entities.QuestionOpen {
+		sb.WriteString(l.T("questions.answer_hint"))
+	}
+
+	// Разбивка на части, если слишком длинно
+	b.sendLong(chatID, sb.String())
+}
+
+// parseQuestionArgs разбирает «<номер> [текст]» из аргументов команды.
+func parseQuestionArgs(args string) (int64, string, bool) {
+	rawID, text, _ := strings.Cut(args, " ")
+	id, err := strconv.ParseInt(strings.TrimPrefix(rawID, "№"), 10, 64)
+	return id, strings.TrimSpace(text), err == nil
+}
+
+// answerQuestion отправляет ответ сотрудника в чат автора вопроса по команде
+// «/answer <id> <текст>». Ответ записывается в историю диалога пользователя.
+func (b *Bot) answerQuestion(ctx context.Context, userID, chatID int64, args string) {
+	l := b.langFor(ctx, chatID)
+	id, answer, ok := parseQuestionArgs(args)
+	if !ok || answer == "" {
+		b.send(chatID, l.T("questions.answer_usage"))
+		return
+	}
+
+	q, err := b.store.Questions.GetUserQuestion(ctx, id)
+	if err != nil {
+		log.Printf("Ошибка при получении вопроса %d: %v", id, err)
+		b.send(chatID, l.T("questions.get_error"))
+		return
+	}
+	if q == nil {
+		b.send(chatID, l.T("questions.not_found"))
+		return
+	}
+	if q.Status == entities.QuestionClosed {
+		b.send(chatID, l.T("questions.closed_no_answer", id))
+		return
+	}
+
+	text := b.langFor(ctx, q.UserID).T("questions.answer_to_user", q.QuestionText, answer)
+	if _, err := b.msgr.SendText(q.UserID, text); err != nil {
+		log.Printf("Ошибка при отправке ответа на вопрос %d в чат %d: %v", id, q.UserID, err)
+		b.send(chatID, l.T("questions.answer_delivery_error"))
+		return
+	}
+	if err := b.store.Conversations.SaveMessage(ctx, q.UserID, "operator", text); err != nil {
+		log.Printf("Ошибка при сохранении исходящего сообщения: %v", err)
+	}
+	if err := b.store.Questions.AnswerUserQuestion(ctx, id, answer, userID); err != nil {
+		log.Printf("Ошибка при сохранении ответа на вопрос %d: %v", id, err)
+		b.send(chatID, l.T("questions.answer_not_saved"))
+		return
+	}
+
+	b.send(chatID, l.T("questions.answer_sent", id, q.Name))
+}
+
+// closeQuestion закрывает вопрос по команде «/closequestion <id>», например
+// если пользователю ответили по телефону.
+func (b *Bot) closeQuestion(ctx context.Context, chatID int64, args string) {
+	l := b.langFor(ctx, chatID)
+	id, _, ok := parseQuestionArgs(args)
+	if !ok {
+		b.send(chatID, l.T("questions.close_usage"))
+		return
+	}
+	if err := b.store.Questions.CloseUserQuestion(ctx, id); err != nil {
+		log.Printf("Ошибка при закрытии вопроса %d: %v", id, err)
+		b.send(chatID, l.T("questions.close_not_found"))
+		return
+	}
+	b.send(chatID, l.T("questions.closed", id))
 }
@@ -0,0 +1,89 @@
+package tgbot
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"tgbot/internal/entities"
+)
+
+// commandRoles перечисляет служебные команды и роли, которым они доступны.
+// Команд, которых здесь нет, может вызвать любой пользователь.
+var commandRoles = map[string][]entities.Role{
+	"/enrollments": {entities.RoleOwner, entities.RoleManager},
+	"/questions":   {entities.RoleOwner, entities.RoleManager, entities.RoleTeacher},
+
+	"/answer":        {entities.RoleOwner, entities.RoleManager, entities.RoleTeacher},
+	"/closequestion": {entities.RoleOwner, entities.RoleManager, entities.RoleTeacher},
+
+	"/addcourse":     {entities.RoleOwner, entities.RoleManager},
+	"/editcourse":    {entities.RoleOwner, entities.RoleManager},
+	"/archivecourse": {entities.RoleOwner, entities.RoleManager},
+
+	"/cancelenrollment": {entities.RoleOwner, entities.RoleManager},
+	"/testresults":      {entities.RoleOwner, entities.RoleManager, entities.RoleTeacher},
+}
+
+func roleAllowed(role entities.Role, allowed []entities.Role) bool {
+	for _, r := range allowed {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// authorize проверяет, может ли userID выполнить команду. Каждая попытка
+// вызвать служебную команду записывается в журнал аудита.
+func (b *Bot) authorize(ctx context.Context, userID, chatID int64, command string) bool {
+	allowed, restricted := commandRoles[command]
+	if !restricted {
+		return true
+	}
+
+	role, err := b.store.Admins.GetAdminRole(ctx, userID)
+	if err != nil {
+		log.Printf("Ошибка при проверке роли пользователя %d: %v", userID, err)
+	}
+	ok := err == nil && roleAllowed(role, allowed)
+
+	if err := b.store.Admins.SaveAuditEntry(ctx, userID, command, ok); err != nil {
+		log.Printf("Ошибка при записи в журнал аудита: %v", err)
+	}
+	if !ok {
+		log.Printf("Доступ запрещён: пользователь %d (роль %q) вызвал %s", userID, role, command)
+		b.send(chatID, b.langFor(ctx, chatID).T("common.staff_only"))
+	}
+	return ok
+}
+
+// ParseAdmins разбирает список сотрудников вида "123:owner,456:manager".
+func ParseAdmins(spec string) (map[int64]entities.Role, error) {
+	admins := make(map[int64]entities.Role)
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		idPart, rolePart, found := strings.Cut(item, ":")
+		if !found {
+			return nil, fmt.Errorf("admin %q: expected <telegram_id>:<role>", item)
+		}
+		userID, err := strconv.ParseInt(strings.TrimSpace(idPart), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("admin %q: invalid telegram id: %w", item, err)
+		}
+		role := entities.Role(strings.ToLower(strings.TrimSpace(rolePart)))
+		switch role {
+		case entities.RoleOwner, entities.RoleManager, entities.RoleTeacher:
+		default:
+			return nil, fmt.Errorf("admin %q: unknown role %q", item, role)
+		}
+		admins[userID] = role
+	}
+	return admins, nil
+}
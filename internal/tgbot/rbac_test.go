@@ -0,0 +1,80 @@
+package tgbot
+
+import (
+	"strings"
+	"testing"
+
+	"tgbot/internal/entities"
+)
+
+func TestStaffCommandsDuringOnboarding(t *testing.T) {
+	tb := newTestBot(t)
+	l := tb.bot.catalogs.Localizer("ru")
+	const staffID, userID = 1, 2
+	if err := tb.store.Admins.SaveAdmin(tb.ctx, staffID, entities.RoleManager); err != nil {
+		t.Fatalf("SaveAdmin: %v", err)
+	}
+
+	// Сотрудник ещё не представился, но служебная команда выполняется
+	tb.say(staffID, "/enrollments")
+	tb.expect(staffID, l.T("enrollments.empty"))
+	if step := tb.state(staffID).Step; step != string(StateIdle) {
+		t.Fatalf("команда сдвинула шаг знакомства: %q", step)
+	}
+
+	// Обычному пользователю на шаге знакомства команда по-прежнему запрещена
+	tb.say(userID, "/start")
+	tb.say(userID, "/enrollments")
+	tb.expect(userID, l.T("common.staff_only"))
+	if step := tb.state(userID).Step; step != string(StateWaitingForName) {
+		t.Fatalf("шаг после запрещённой команды: %q", step)
+	}
+}
+
+func TestCourseDialogDuringTest(t *testing.T) {
+	tb := newTestBot(t)
+	l := tb.bot.catalogs.Localizer("ru")
+	const staffID = 1
+	if err := tb.store.Admins.SaveAdmin(tb.ctx, staffID, entities.RoleManager); err != nil {
+		t.Fatalf("SaveAdmin: %v", err)
+	}
+
+	tb.say(staffID, "/start")
+	tb.say(staffID, "Иван")
+	tb.say(staffID, "+7 701 123-45-67")
+	tb.click(staffID, "Go")
+	if us := tb.state(staffID); !us.IsTakingTest {
+		t.Fatalf("тест не начался: шаг %q", us.Step)
+	}
+
+	// Диалог курса прерывает тест, и после него работают обычные команды
+	tb.say(staffID, "/archivecourse 1")
+	tb.say(staffID, l.T("button.no"))
+	us := tb.state(staffID)
+	if us.IsTakingTest || us.TestAttemptID != 0 || us.CourseDraft != nil {
+		t.Fatalf("после диалога курса: %+v", us)
+	}
+	tb.say(staffID, "/courses")
+	if got := tb.texts(staffID); len(got) != 1 || !strings.HasPrefix(got[0], l.T("courses.header")) {
+		t.Fatalf("ответ на /courses после диалога курса: %q", got)
+	}
+}
+
+func TestCommandsForOnboardingKeepsStaffCommands(t *testing.T) {
+	us := &entities.UserState{Step: string(StateTakingTest), IsTakingTest: true}
+	commands := commandsFor(entities.RoleTeacher, us)
+	has := func(command string) bool {
+		for _, c := range commands {
+			if c == command {
+				return true
+			}
+		}
+		return false
+	}
+	if !has("/questions") || !has("/testresults") {
+		t.Errorf("во время теста у преподавателя нет служебных команд: %v", commands)
+	}
+	if has("/courses") || has("/enrollments") {
+		t.Errorf("во время теста доступны лишние команды: %v", commands)
+	}
+}
@@ -0,0 +1,67 @@
+package tgbot
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+
+	"tgbot/internal/entities"
+	"tgbot/internal/storage"
+)
+
+// StateStore хранит состояния диалогов в базе и кэширует их в памяти.
+// Мьютекс защищает только карту кэша: запросы к базе идут без него, чтобы
+// чаты не ждали друг друга. Обновления одного чата и так обрабатываются
+// по очереди диспетчером.
+type StateStore struct {
+	repo storage.UserStateRepository
+
+	mu    sync.Mutex
+	cache map[int64]entities.UserState
+}
+
+func NewStateStore(repo storage.UserStateRepository) *StateStore {
+	return &StateStore{
+		repo:  repo,
+		cache: make(map[int64]entities.UserState),
+	}
+}
+
+// Get возвращает копию состояния пользователя. Изменения копии
+// не видны другим горутинам, пока не будет вызван Save. Если состояние
+// не удалось загрузить, его нельзя сохранять: пустое состояние затёрло бы
+// имя, телефон и прогресс теста.
+func (s *StateStore) Get(ctx context.Context, chatID int64) (*entities.UserState, error) {
+	s.mu.Lock()
+	state, ok := s.cache[chatID]
+	s.mu.Unlock()
+	if ok {
+		return &state, nil
+	}
+
+	loaded, err := s.repo.GetUserState(ctx, chatID)
+	if err != nil {
+		return nil, fmt.Errorf("load state of chat %d: %w", chatID, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// Пока шёл запрос, состояние могли сохранить — оно новее загруженного
+	if state, ok := s.cache[chatID]; ok {
+		return &state, nil
+	}
+	s.cache[chatID] = *loaded
+	return loaded, nil
+}
+
+func (s *StateStore) Save(ctx context.Context, chatID int64, state *entities.UserState) {
+	if err := s.repo.SaveUserState(ctx, chatID, state); err != nil {
+		log.Printf("Ошибка при сохранении состояния пользователя %d: %v", chatID, err)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cache[chatID] = *state
+}
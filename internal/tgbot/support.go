@@ -0,0 +1,96 @@
+package tgbot
+
+import (
+	"context"
+	"log"
+	"strings"
+
+	"tgbot/internal/entities"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+// Чат с менеджером: сообщения пользователя копируются в группу сотрудников,
+// а ответы сотрудников (reply на эти копии) возвращаются пользователю.
+const StateSupport State = "support_chat"
+
+func (b *Bot) startSupport(ctx context.Context, chatID int64, us *entities.UserState) {
+	if b.supportChat == 0 {
+		// Без группы поддержки остаётся только оставить вопрос
+		b.reply(ctx, chatID, b.lang(us).T("support.unavailable"))
+		if err := conversation.Jump(b, ctx, chatID, us, StateWaitingForQuestionText); err != nil {
+			log.Printf("Ошибка перехода к вопросу: %v", err)
+		}
+		return
+	}
+	if err := conversation.Jump(b, ctx, chatID, us, StateSupport); err != nil {
+		log.Printf("Ошибка перехода в чат с менеджером: %v", err)
+	}
+}
+
+func (b *Bot) enterSupport(ctx context.Context, chatID int64, us *entities.UserState) {
+	b.relayToSupport(ctx, chatID, us, b.langFor(ctx, b.supportChat).T("support.staff_opened"))
+	b.replyKeyboard(ctx, chatID, b.lang(us).T("support.connected"), columnKeyboard(b.choiceButton(us, choiceEndSupport)))
+}
+
+func (b *Bot) handleSupport(ctx context.Context, in input, us *entities.UserState) State {
+	if b.isChoice(us, in.text, choiceEndSupport) || strings.EqualFold(in.text, "/endsupport") {
+		b.relayToSupport(ctx, in.chatID, us, b.langFor(ctx, b.supportChat).T("support.staff_closed"))
+		b.replyKeyboard(ctx, in.chatID, b.lang(us).T("support.ended"), b.chooseCourseKeyboard(us))
+		return StateIdle
+	}
+	if in.text == "" {
+		b.reply(ctx, in.chatID, b.lang(us).T("support.text_only"))
+		return StateSupport
+	}
+
+	if !b.relayToSupport(ctx, in.chatID, us, in.text) {
+		b.reply(ctx, in.chatID, b.lang(us).T("support.relay_error"))
+	}
+	return StateSupport
+}
+
+// relayToSupport копирует текст в группу поддержки с заголовком об авторе.
+func (b *Bot) relayToSupport(ctx context.Context, chatID int64, us *entities.UserState, text string) bool {
+	header := b.langFor(ctx, b.supportChat).T("support.staff_header", us.Name, us.PhoneNumber, chatID)
+	messageID, err := b.msgr.SendText(b.supportChat, header+"\n\n"+text)
+	if err != nil {
+		log.Printf("Ошибка при пересылке сообщения в чат поддержки: %v", err)
+		return false
+	}
+	if err := b.store.Support.SaveSupportMessage(ctx, b.supportChat, messageID, chatID); err != nil {
+		log.Printf("Ошибка при сохранении сообщения поддержки: %v", err)
+	}
+	return true
+}
+
+// handleSupportGroup обрабатывает сообщения в группе поддержки: ответ на
+// копию сообщения пользователя отправляется этому пользователю. Остальная
+// переписка сотрудников игнорируется.
+func (b *Bot) handleSupportGroup(ctx context.Context, msg *tgbotapi.Message) {
+	if msg.ReplyToMessage == nil || msg.Text == "" {
+		return
+	}
+	userID, err := b.store.Support.SupportMessageUser(ctx, msg.Chat.ID, msg.ReplyToMessage.MessageID)
+	if err != nil {
+		log.Printf("Ошибка при поиске сообщения поддержки: %v", err)
+		return
+	}
+	if userID == 0 {
+		return
+	}
+
+	text := b.langFor(ctx, userID).T("support.manager_reply", msg.Text)
+	if _, err := b.msgr.SendText(userID, text); err != nil {
+		log.Printf("Ошибка при отправке ответа менеджера в чат %d: %v", userID, err)
+		b.send(msg.Chat.ID, b.langFor(ctx, msg.Chat.ID).T("support.delivery_error"))
+		return
+	}
+	if err := b.store.Conversations.SaveMessage(ctx, userID, "operator", msg.Text); err != nil {
+		log.Printf("Ошибка при сохранении исходящего сообщения: %v", err)
+	}
+	// Ответ на ответ тоже должен дойти до пользователя
+	if err := b.store.Support.SaveSupportMessage(ctx, msg.Chat.ID, msg.MessageID, userID); err != nil {
+		log.Printf("Ошибка при сохранении сообщения поддержки: %v", err)
+	}
+}
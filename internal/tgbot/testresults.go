@@ -0,0 +1,202 @@
+package tgbot
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"tgbot/internal/entities"
+	"tgbot/internal/i18n"
+	"tgbot/internal/quiz"
+)
+
+// Каждая попытка теста записывается в test_attempts, а каждый показанный
+// вопрос — в test_answers, даже если пользователь бросил тест. По ним
+// сотрудники находят плохие вопросы и пользователей, которые прошли тест,
+// но не записались на курс. Ошибки записи тест не прерывают.
+
+// recentTestAttempts — сколько попыток показывает /testresults без аргумента.
+const recentTestAttempts = 20
+
+func (b *Bot) startTestAttempt(ctx context.Context, chatID int64, bank *quiz.Bank, us *entities.UserState) {
+	id, err := b.store.Tests.StartTestAttempt(ctx, chatID, bank.Track, us.TestSeed, b.jobs.Now())
+	if err != nil {
+		log.Printf("Ошибка при сохранении попытки теста пользователя %d: %v", chatID, err)
+	}
+	us.TestAttemptID = id
+}
+
+func (b *Bot) recordTestQuestion(ctx context.Context, us *entities.UserState, position, index int, q quiz.Question) {
+	if us.TestAttemptID == 0 {
+		return
+	}
+	err := b.store.Tests.SaveTestQuestion(ctx, us.TestAttemptID, entities.TestAttemptAnswer{
+		Position: position,
+		Question: index,
+		Text:     q.Question,
+		Topic:    q.Topic,
+		Level:    q.Level,
+		ShownAt:  b.jobs.Now(),
+	})
+	if err != nil {
+		log.Printf("Ошибка при сохранении вопроса теста: %v", err)
+	}
+}
+
+func (b *Bot) recordTestAnswer(ctx context.Context, us *entities.UserState, position int, q quiz.Question, option int, correct bool) {
+	if us.TestAttemptID == 0 {
+		return
+	}
+	if err := b.store.Tests.SaveTestAnswer(ctx, us.TestAttemptID, position, option, q.Options[option], correct, b.jobs.Now()); err != nil {
+		log.Printf("Ошибка при сохранении ответа на вопрос теста: %v", err)
+	}
+}
+
+func (b *Bot) finishTestAttempt(ctx context.Context, us *entities.UserState, result quiz.Result) {
+	if us.TestAttemptID == 0 {
+		return
+	}
+	attempt := entities.TestAttempt{
+		ID:          us.TestAttemptID,
+		Score:       result.Correct,
+		Total:       result.Total,
+		Level:       levelForScore(result.Correct, result.Total, b.settings.Levels),
+		TopicLevels: make(map[string]string, len(result.Topics)),
+		FinishedAt:  b.jobs.Now(),
+	}
+	for _, t := range result.Topics {
+		attempt.TopicLevels[t.Topic] = t.Level
+	}
+	if err := b.store.Tests.FinishTestAttempt(ctx, attempt); err != nil {
+		log.Printf("Ошибка при сохранении результата теста: %v", err)
+	}
+	us.TestAttemptID = 0
+}
+
+// sendTestResults обрабатывает /testresults. Без аргумента показывает
+// последние попытки всех пользователей, с Telegram ID или телефоном —
+// все попытки пользователя с ответами на каждый вопрос.
+func (b *Bot) sendTestResults(ctx context.Context, chatID int64, args string) {
+	l := b.langFor(ctx, chatID)
+	if args == "" {
+		b.sendRecentTestAttempts(ctx, chatID, l)
+		return
+	}
+
+	userID, ok := b.findTestUser(ctx, args)
+	if !ok {
+		b.send(chatID, l.T("testresults.not_found", args))
+		return
+	}
+	attempts, err := b.store.Tests.GetTestAttempts(ctx, userID)
+	if err != nil {
+		log.Printf("Ошибка при получении попыток теста пользователя %d: %v", userID, err)
+		b.send(chatID, l.T("testresults.error"))
+		return
+	}
+	if len(attempts) == 0 {
+		b.send(chatID, l.T("testresults.user_empty", userID))
+		return
+	}
+
+	var sb strings.Builder
+	for _, a := range attempts {
+		b.writeTestAttempt(&sb, l, a)
+		for _, answer := range a.Answers {
+			sb.WriteString(l.T("testresults.question", answer.Position, answer.Text, levelName(l, answer.Level)))
+			if !answer.Answered() {
+				sb.WriteString(l.T("testresults.no_answer"))
+				continue
+			}
+			mark := "❌"
+			if answer.Correct {
+				mark = "✅"
+			}
+			sb.WriteString(l.T("testresults.answer", mark, answer.AnswerText, answerDuration(answer)))
+		}
+		sb.WriteString("\n")
+	}
+	b.sendLong(chatID, sb.String())
+}
+
+// findTestUser находит пользователя по номеру телефона из профиля или
+// Telegram ID. Число, похожее на номер, сначала ищется среди телефонов.
+func (b *Bot) findTestUser(ctx context.Context, arg string) (int64, bool) {
+	if phone, err := normalizePhone(arg); err == nil {
+		user, err := b.store.Users.FindUserByPhone(ctx, phone)
+		if err != nil {
+			log.Printf("Ошибка при поиске пользователя по телефону: %v", err)
+		}
+		if user != nil {
+			return user.TelegramID, true
+		}
+	}
+	if strings.HasPrefix(arg, "+") {
+		return 0, false
+	}
+	id, err := strconv.ParseInt(arg, 10, 64)
+	return id, err == nil && id > 0
+}
+
+func (b *Bot) sendRecentTestAttempts(ctx context.Context, chatID int64, l *i18n.Localizer) {
+	attempts, err := b.store.Tests.RecentTestAttempts(ctx, recentTestAttempts)
+	if err != nil {
+		log.Printf("Ошибка при получении попыток теста: %v", err)
+		b.send(chatID, l.T("testresults.error"))
+		return
+	}
+	if len(attempts) == 0 {
+		b.send(chatID, l.T("testresults.empty"))
+		return
+	}
+
+	var sb strings.Builder
+	sb.WriteString(l.T("testresults.header"))
+	for _, a := range attempts {
+		b.writeTestAttempt(&sb, l, a)
+		sb.WriteString("\n")
+	}
+	sb.WriteString(l.T("testresults.footer"))
+	b.sendLong(chatID, sb.String())
+}
+
+// writeTestAttempt пишет заголовок попытки: кто, когда, результат и
+// записался ли пользователь на курс.
+func (b *Bot) writeTestAttempt(sb *strings.Builder, l *i18n.Localizer, a entities.TestAttempt) {
+	title := a.Track
+	bank, hasBank := b.banks.Get(a.Track)
+	if hasBank {
+		title = bank.Title
+	}
+	sb.WriteString(l.T("testresults.attempt", a.ID, a.Name, a.PhoneNumber, a.UserID, title, a.StartedAt.Local().Format("02.01.2006 15:04")))
+
+	if !a.Finished() {
+		sb.WriteString(l.T("testresults.unfinished"))
+	} else {
+		sb.WriteString(l.T("testresults.score", a.Score, a.Total, levelName(l, a.Level)))
+		// Темы — в порядке банка, чтобы попытки читались одинаково
+		if hasBank {
+			for _, t := range bank.Topics {
+				if level, ok := a.TopicLevels[t.ID]; ok {
+					sb.WriteString(l.T("testresults.topic", t.Name(l.Language()), levelName(l, level)))
+				}
+			}
+		}
+		if level, ok := a.TopicLevels[""]; ok {
+			sb.WriteString(l.T("testresults.topic", title, levelName(l, level)))
+		}
+	}
+
+	if a.Enrolled {
+		sb.WriteString(l.T("testresults.enrolled"))
+	} else {
+		sb.WriteString(l.T("testresults.not_enrolled"))
+	}
+}
+
+// answerDuration — сколько секунд пользователь думал над вопросом.
+func answerDuration(a entities.TestAttemptAnswer) int {
+	return int(a.AnsweredAt.Sub(a.ShownAt).Round(time.Second) / time.Second)
+}
@@ -1,309 +1,551 @@
 package tgbot
 
 import (
-	"database/sql"
+	"context"
+	"errors"
 	"fmt"
 	"log"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"tgbot/internal/entities"
+	"tgbot/internal/i18n"
+	"tgbot/internal/quiz"
+	"tgbot/internal/scheduler"
 	"tgbot/internal/storage"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
 )
 
-type TestQuestion struct {
-	Question string
-	Options  []string
-	Answer   int
+// Максимальное число обновлений, обрабатываемых одновременно
+const maxConcurrentUpdates = 16
+
+// Как часто проверять отложенные задачи
+const jobsPollInterval = 30 * time.Second
+
+// Bot содержит всё, что нужно обработчикам диалога. Telegram скрыт за
+// интерфейсом Messenger, поэтому бота можно запускать с фейковым транспортом.
+type Bot struct {
+	store    *storage.Store
+	msgr     Messenger
+	states   *StateStore
+	banks    *quiz.Banks
+	catalogs *i18n.Bundle
+	payments PaymentProvider
+	jobs     *scheduler.Scheduler
+	// chats раздаёт обновления по чатам; через него же отправляются
+	// отложенные сообщения, чтобы они не обгоняли обработчик чата
+	chats *dispatcher
+
+	// supportChat — группа сотрудников для чата с менеджером, 0 — чат выключен
+	supportChat int64
+	settings    Settings
+
+	// courses заменяется целиком при изменении курсов, сам срез не меняется
+	coursesMu sync.RWMutex
+	courses   []entities.Course
 }
 
-func Run(bot *tgbotapi.BotAPI, db *sql.DB) error {
-	u := tgbotapi.NewUpdate(0)
-	u.Timeout = 60
-	updates, err := bot.GetUpdatesChan(u)
+// NewBot регистрирует свои обработчики в jobs; запускать jobs.Run должен вызывающий.
+func NewBot(ctx context.Context, store *storage.Store, msgr Messenger, banks *quiz.Banks, catalogs *i18n.Bundle, payments PaymentProvider, jobs *scheduler.Scheduler) (*Bot, error) {
+	courses, err := store.Courses.GetCourses(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to get updates: %w", err)
-	}
+		return nil, fmt.Errorf("failed to fetch courses: %w", err)
+	}
+
+	b := &Bot{
+		store:    store,
+		msgr:     msgr,
+		states:   NewStateStore(store.UserStates),
+		courses:  courses,
+		banks:    banks,
+		catalogs: catalogs,
+		payments: payments,
+		jobs:     jobs,
+		settings: DefaultSettings(),
+	}
+	jobs.Handle(jobPaymentReminder, b.sendPaymentReminder)
+	jobs.Handle(jobSeatOfferExpire, b.expireSeatOffer)
+	return b, nil
+}
 
-	courses, err := storage.GetCourses(db)
+// courseList возвращает курсы, открытые для записи.
+func (b *Bot) courseList() []entities.Course {
+	b.coursesMu.RLock()
+	defer b.coursesMu.RUnlock()
+	return b.courses
+}
+
+// refreshCourses перечитывает курсы из базы после их изменения.
+func (b *Bot) refreshCourses(ctx context.Context) error {
+	courses, err := b.store.Courses.GetCourses(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to fetch courses: %w", err)
 	}
+	b.coursesMu.Lock()
+	b.courses = courses
+	b.coursesMu.Unlock()
+	return nil
+}
 
-	for update := range updates {
-		if update.Message == nil {
-			continue
-		}
+// Options — настройки запуска бота.
+type Options struct {
+	// PaymentToken — токен платёжного провайдера
+	PaymentToken string
+	// FakePayments выставляет счета через FakePaymentProvider. Нужен явно:
+	// без токена и без него Run не запускается
+	FakePayments bool
+	// SupportChatID — группа сотрудников для /support; 0 — чат выключен
+	SupportChatID int64
+	// Webhook включает приём обновлений через webhook вместо long polling
+	Webhook *WebhookOptions
+	// Settings — параметры поведения; нулевые поля берутся из DefaultSettings
+	Settings Settings
+}
+
+// Settings — параметры поведения бота, которые задаются конфигурацией.
+type Settings struct {
+	// PollTimeout — таймаут long polling getUpdates
+	PollTimeout time.Duration
+	// MessageChunkSize — на какие части делить длинные сообщения (лимит Telegram — 4096)
+	MessageChunkSize int
+	// PaymentReminderDelay — через сколько напомнить об оплате после отказа
+	PaymentReminderDelay time.Duration
+	// SeatOfferTTL — сколько действует предложение освободившегося места
+	SeatOfferTTL time.Duration
+	// Levels — границы общего уровня по доле правильных ответов теста
+	Levels LevelThresholds
+	// ShutdownTimeout — сколько ждать начатые обработчики при остановке
+	ShutdownTimeout time.Duration
+}
 
-		HandleConversation(db, bot, courses, update)
+// LevelThresholds — доли правильных ответов (от 0 до 1), до которых
+// включительно назначается начальный и средний уровень.
+type LevelThresholds struct {
+	Beginner     float64
+	Intermediate float64
+}
+
+func DefaultSettings() Settings {
+	return Settings{
+		PollTimeout:          60 * time.Second,
+		MessageChunkSize:     4000,
+		PaymentReminderDelay: 24 * time.Hour,
+		SeatOfferTTL:         24 * time.Hour,
+		Levels:               LevelThresholds{Beginner: 0.3, Intermediate: 0.7},
+		ShutdownTimeout:      10 * time.Second,
 	}
+}
 
-	return nil
+// withDefaults заменяет незаданные поля значениями по умолчанию.
+func (s Settings) withDefaults() Settings {
+	d := DefaultSettings()
+	if s.PollTimeout == 0 {
+		s.PollTimeout = d.PollTimeout
+	}
+	if s.MessageChunkSize == 0 {
+		s.MessageChunkSize = d.MessageChunkSize
+	}
+	if s.PaymentReminderDelay == 0 {
+		s.PaymentReminderDelay = d.PaymentReminderDelay
+	}
+	if s.SeatOfferTTL == 0 {
+		s.SeatOfferTTL = d.SeatOfferTTL
+	}
+	if s.Levels == (LevelThresholds{}) {
+		s.Levels = d.Levels
+	}
+	if s.ShutdownTimeout == 0 {
+		s.ShutdownTimeout = d.ShutdownTimeout
+	}
+	return s
 }
 
-var userStates = make(map[int64]*entities.UserState)
+// Run получает обновления и обрабатывает их, пока не отменён ctx. После
+// отмены бот перестаёт принимать обновления и ждёт начатые обработчики не
+// дольше Settings.ShutdownTimeout. Базу закрывает вызывающий, когда Run вернётся.
+func Run(ctx context.Context, api *tgbotapi.BotAPI, store *storage.Store, banks *quiz.Banks, catalogs *i18n.Bundle, opts Options) error {
+	msgr := NewTelegramMessenger(api)
+	var payments PaymentProvider
+	switch {
+	case opts.PaymentToken != "":
+		payments = NewTelegramPayments(api, opts.PaymentToken)
+	case opts.FakePayments:
+		log.Println("Включены тестовые счета: оплата проходит без списания денег")
+		payments = NewFakePaymentProvider(msgr)
+	default:
+		return errors.New("no payment provider: set a payment token or enable fake payments")
+	}
 
-func HandleConversation(botDB *sql.DB, bot *tgbotapi.BotAPI, courses []entities.Course, update tgbotapi.Update) {
-	text := update.Message.Text
-	chatID := update.Message.Chat.ID
-	userState := getUserState(chatID)
+	jobs := scheduler.New(store.Jobs, scheduler.RealClock())
+	bot, err := NewBot(ctx, store, msgr, banks, catalogs, payments, jobs)
+	if err != nil {
+		return err
+	}
+	bot.supportChat = opts.SupportChatID
+	bot.settings = opts.Settings.withDefaults()
+	if err := registerCommands(ctx, api, store.Admins, catalogs); err != nil {
+		log.Printf("Ошибка при регистрации команд в Telegram: %v", err)
+	}
+	shutdownTimeout := bot.settings.ShutdownTimeout
 
-	if userState.Step == "" && userState.Name == "" {
-		userState.Step = "waiting_for_name"
-		msg := tgbotapi.NewMessage(chatID, "Привет! Напиши своё имя, чтобы начать.")
-		if _, err := bot.Send(msg); err != nil {
-			log.Printf("Ошибка при отправке приветствия: %v", err)
+	updates, updateErrs, stopUpdates, err := updatesChannel(ctx, api, opts.Webhook, bot.settings)
+	if err != nil {
+		return err
+	}
+
+	// Отложенные задачи останавливаются и по ctx, и при ошибке источника обновлений
+	ctx, stop := context.WithCancel(ctx)
+	defer stop()
+	jobsDone := make(chan struct{})
+	go func() {
+		defer close(jobsDone)
+		jobs.Run(ctx, jobsPollInterval)
+	}()
+
+	// Обработчики не должны обрываться посреди записи в базу, поэтому их
+	// контекст отменяется не вместе с ctx, а только по истечении shutdownTimeout.
+	handlerCtx, cancelHandlers := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancelHandlers()
+	d := newDispatcher(maxConcurrentUpdates, func(update tgbotapi.Update) {
+		bot.HandleConversation(handlerCtx, update)
+	})
+	bot.chats = d
+
+	dispatch := func(update tgbotapi.Update) {
+		if update.Message == nil && update.CallbackQuery == nil && update.PreCheckoutQuery == nil {
+			return
+		}
+		d.Dispatch(update)
+	}
+
+	var runErr error
+loop:
+	for {
+		select {
+		case <-ctx.Done():
+			break loop
+		case err := <-updateErrs:
+			log.Printf("Ошибка webhook-сервера: %v", err)
+			runErr = fmt.Errorf("webhook server: %w", err)
+			break loop
+		case update := <-updates:
+			dispatch(update)
 		}
-		return
 	}
 
-	if userState.Step == "waiting_for_name" {
-		userState.Name = strings.TrimSpace(text)
-		userState.Step = "waiting_for_phone" // Changed next step
-		msg := tgbotapi.NewMessage(chatID, "Теперь, пожалуйста, введите ваш номер телефона.")
-		if _, err := bot.Send(msg); err != nil {
-			log.Printf("Ошибка при отправке запроса номера телефона: %v", err)
+	log.Println("Остановка: больше не принимаем обновления")
+	stop()
+	stopUpdates()
+	// Обновления, которые уже получены, но ещё не розданы, тоже обрабатываем
+	for pending := true; pending; {
+		select {
+		case update := <-updates:
+			dispatch(update)
+		default:
+			pending = false
 		}
-		return
 	}
 
-	if userState.Step == "waiting_for_phone" {
-		userState.PhoneNumber = strings.TrimSpace(text)
-		userState.Step = "taking_test"
-		userState.IsTakingTest = true
-		userState.TestIndex = 0
-		userState.TestScore = 0
+	// Обработчики и отложенные задачи укладываются в один общий shutdownTimeout
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancelShutdown()
+	if !d.Wait(shutdownCtx.Done()) {
+		log.Printf("Обработчики не завершились за %s, прерываем", shutdownTimeout)
+		cancelHandlers()
+	}
+	d.Close()
+	select {
+	case <-jobsDone:
+	case <-shutdownCtx.Done():
+		log.Println("Отложенные задачи не завершились вовремя")
+	}
+	return runErr
+}
 
-		bot.Send(tgbotapi.NewMessage(chatID, fmt.Sprintf("Спасибо, %s! Сейчас начнётся тест из 10 вопросов. Отвечай, выбрав номер варианта от 1 до 4.", userState.Name)))
-		sendTestQuestion(bot, chatID, 0)
-		return
+// updatesChannel возвращает источник обновлений (webhook или long polling),
+// канал его ошибок и функцию, которая прекращает получение обновлений.
+// У long polling канал ошибок nil: tgbotapi повторяет запросы сам.
+func updatesChannel(ctx context.Context, api *tgbotapi.BotAPI, webhook *WebhookOptions, s Settings) (<-chan tgbotapi.Update, <-chan error, func(), error) {
+	if webhook != nil {
+		return listenWebhook(ctx, api, *webhook, s.ShutdownTimeout)
 	}
 
-	if userState.IsTakingTest {
-		handleTestStep(bot, botDB, chatID, text, userState, courses)
-		return
+	// getUpdates не работает, пока зарегистрирован webhook
+	if _, err := api.RemoveWebhook(); err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to remove webhook: %w", err)
 	}
+	u := tgbotapi.NewUpdate(0)
+	u.Timeout = int(s.PollTimeout / time.Second)
+	updates, err := api.GetUpdatesChan(u)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to get updates: %w", err)
+	}
+	return updates, nil, api.StopReceivingUpdates, nil
+}
 
-	switch text {
-	case "/history":
-		sendHistory(botDB, bot, chatID)
+func (b *Bot) HandleConversation(ctx context.Context, update tgbotapi.Update) {
+	if update.CallbackQuery != nil {
+		b.handleCallback(ctx, update.CallbackQuery)
 		return
-	case "/courses":
-		sendCourses(bot, chatID, courses)
+	}
+	if update.PreCheckoutQuery != nil {
+		b.handlePreCheckout(ctx, update.PreCheckoutQuery)
 		return
-	case "/teachers":
-		sendTeachers(bot, chatID, courses)
+	}
+	if update.Message == nil {
 		return
-	case "/schedule":
-		sendSchedules(bot, chatID, courses)
+	}
+	if update.Message.SuccessfulPayment != nil {
+		b.handleSuccessfulPayment(ctx, update.Message.Chat.ID, update.Message.SuccessfulPayment)
 		return
-	case "/enrollments":
-		sendEnrollments(botDB, bot, chatID)
+	}
+
+	text := update.Message.Text
+	if text == "" && update.Message.Contact != nil {
+		// В историю диалога контакт попадает номером телефона
+		text = update.Message.Contact.PhoneNumber
+	}
+	chatID := update.Message.Chat.ID
+	if b.supportChat != 0 && chatID == b.supportChat {
+		b.handleSupportGroup(ctx, update.Message)
+		return
+	}
+	userID := chatID
+	if update.Message.From != nil {
+		userID = int64(update.Message.From.ID)
+	}
+	userState, err := b.states.Get(ctx, chatID)
+	if err != nil {
+		log.Printf("Ошибка при загрузке состояния пользователя: %v", err)
+		b.send(chatID, b.lang(&entities.UserState{}).T("common.try_later"))
 		return
-	case "/questions": // Added /questions command
-		sendUserQuestions(botDB, bot, chatID)
+	}
+	// Состояние сохраняется после каждого шага, чтобы перезапуск бота не обрывал диалог
+	defer b.states.Save(ctx, chatID, userState)
+	b.detectLanguage(ctx, chatID, userState, update.Message.From)
+	b.recognizeUser(ctx, chatID, userState)
+
+	// /help, /cancel, /restart и /language работают на любом шаге, в том числе во время теста
+	command, args := splitCommand(text)
+	if b.handleGlobalCommand(ctx, userID, chatID, command, args, userState) {
+		return
+	}
+
+	// Служебные команды не ждут конца знакомства: сотруднику не нужно
+	// проходить тест, чтобы работать с ботом
+	_, staff := commandRoles[command]
+	if (staff || !inOnboarding(userState)) && b.handleCommand(ctx, userID, chatID, text, userState) {
 		return
 	}
 
 	// Сохраняем входящее сообщение
-	if err := storage.SaveMessage(botDB, chatID, "user", text); err != nil {
+	if err := b.store.Conversations.SaveMessage(ctx, chatID, "user", text); err != nil {
 		log.Printf("Ошибка при сохранении входящего сообщения: %v", err)
 	}
 
-	var msg tgbotapi.MessageConfig
-
-	switch userState.Step {
-	case "":
-		msg = handleInitialStep(chatID, text, userState, courses)
-
-	case "waiting_for_course_selection":
-		msg = handleCourseSelection(chatID, text, userState, courses)
-
-	case "waiting_for_payment_confirmation":
-		msg = handlePaymentConfirmation(chatID, text, userState, bot, botDB)
+	conversation.Handle(b, ctx, input{chatID: chatID, text: text, contact: update.Message.Contact}, userState)
+}
 
-	case "payment_successful":
-		// Ask if user has questions
-		userState.Step = "waiting_for_questions_prompt"
-		msg = tgbotapi.NewMessage(chatID, "Оплата прошла успешно! Есть ли у вас какие-либо вопросы? (Да/Нет)")
+// handleCommand выполняет команду и сообщает, была ли text командой.
+// Перед выполнением служебных команд проверяются права пользователя.
+func (b *Bot) handleCommand(ctx context.Context, userID, chatID int64, text string, us *entities.UserState) bool {
+	command, args := splitCommand(text)
+	if !b.authorize(ctx, userID, chatID, command) {
+		return true
+	}
 
-	case "waiting_for_questions_prompt":
-		if strings.EqualFold(text, "Да") {
-			userState.Step = "waiting_for_question_text"
-			msg = tgbotapi.NewMessage(chatID, "Пожалуйста, напишите ваш вопрос.")
-		} else if strings.EqualFold(text, "Нет") {
-			msg = tgbotapi.NewMessage(chatID, "Хорошо! Напишите 'Выбрать курс' для нового выбора.")
-			userState.Step = ""
-		} else {
-			msg = tgbotapi.NewMessage(chatID, "Пожалуйста, ответьте 'Да' или 'Нет'.")
-		}
+	switch command {
+	case "/history":
+		b.sendHistory(ctx, chatID)
+	case "/courses":
+		b.sendCourses(chatID, us)
+	case "/teachers":
+		b.sendTeachers(chatID, us)
+	case "/schedule":
+		b.sendSchedules(chatID, us)
+	case "/enrollments":
+		b.sendEnrollments(ctx, chatID)
+	case "/questions":
+		b.sendUserQuestions(ctx, chatID, args)
+	case "/answer":
+		b.answerQuestion(ctx, userID, chatID, args)
+	case "/closequestion":
+		b.closeQuestion(ctx, chatID, args)
+	case "/addcourse":
+		b.startCourseDialog(ctx, chatID, us, entities.CourseAdd, args)
+	case "/editcourse":
+		b.startCourseDialog(ctx, chatID, us, entities.CourseEdit, args)
+	case "/archivecourse":
+		b.startCourseDialog(ctx, chatID, us, entities.CourseArchive, args)
+	case "/support":
+		b.startSupport(ctx, chatID, us)
+	case "/profile":
+		b.startProfile(ctx, chatID, us)
+	case "/waitlist":
+		b.sendWaitlist(ctx, chatID)
+	case "/cancelenrollment":
+		b.cancelEnrollment(ctx, chatID, args)
+	case "/testresults":
+		b.sendTestResults(ctx, chatID, args)
+	default:
+		return false
+	}
+	return true
+}
 
-	case "waiting_for_question_text":
-		// Pass user's name and phone number when saving the question
-		if err := storage.SaveUserQuestion(botDB, chatID, userState.Name, userState.PhoneNumber, text); err != nil {
-			log.Printf("Ошибка при сохранении вопроса пользователя: %v", err)
-			msg = tgbotapi.NewMessage(chatID, "Произошла ошибка при сохранении вашего вопроса. Попробуйте позже.")
-		} else {
-			msg = tgbotapi.NewMessage(chatID, "Ваш вопрос сохранен! Мы скоро с вами свяжемся. Напишите 'Выбрать курс' для нового выбора.")
-		}
-		userState.Step = ""
+// splitCommand отделяет команду от аргументов и убирает суффикс @имя_бота.
+func splitCommand(text string) (command, args string) {
+	text = strings.TrimSpace(text)
+	if !strings.HasPrefix(text, "/") {
+		return "", text
+	}
+	command, args, _ = strings.Cut(text, " ")
+	command, _, _ = strings.Cut(command, "@")
+	return strings.ToLower(command), strings.TrimSpace(args)
+}
 
-	default:
-		msg = tgbotapi.NewMessage(chatID, "Неизвестный шаг. Напишите 'Выбрать курс' для начала.")
-		userState.Step = ""
+// reply отправляет ответ в рамках диалога и сохраняет его в историю.
+func (b *Bot) reply(ctx context.Context, chatID int64, text string) {
+	if err := b.store.Conversations.SaveMessage(ctx, chatID, "bot", text); err != nil {
+		log.Printf("Ошибка при сохранении исходящего сообщения: %v", err)
 	}
+	b.send(chatID, text)
+}
 
-	// Сохраняем исходящее сообщение
-	if err := storage.SaveMessage(botDB, chatID, "bot", msg.Text); err != nil {
+// replyKeyboard — то же, что reply, но с клавиатурой под сообщением.
+func (b *Bot) replyKeyboard(ctx context.Context, chatID int64, text string, keyboard interface{}) {
+	if err := b.store.Conversations.SaveMessage(ctx, chatID, "bot", text); err != nil {
 		log.Printf("Ошибка при сохранении исходящего сообщения: %v", err)
 	}
+	if _, err := b.msgr.SendKeyboard(chatID, text, keyboard); err != nil {
+		log.Printf("Ошибка при отправке сообщения в чат %d: %v", chatID, err)
+	}
+}
 
-	if _, err := bot.Send(msg); err != nil {
-		log.Printf("Ошибка при отправке сообщения: %v", err)
+// send отправляет текст и только логирует ошибку: ответить пользователю о
+// сбое отправки всё равно нельзя.
+func (b *Bot) send(chatID int64, text string) {
+	if _, err := b.msgr.SendText(chatID, text); err != nil {
+		log.Printf("Ошибка при отправке сообщения в чат %d: %v", chatID, err)
 	}
 }
 
-func getUserState(chatID int64) *entities.UserState {
-	if state, exists := userStates[chatID]; exists {
-		return state
+// sendLong отправляет длинный текст частями, укладываясь в лимит Telegram.
+func (b *Bot) sendLong(chatID int64, text string) {
+	chunkSize := b.settings.MessageChunkSize
+	for len(text) > 0 {
+		end := chunkSize
+		if len(text) < chunkSize {
+			end = len(text)
+		}
+		b.send(chatID, text[:end])
+		text = text[end:]
 	}
-	userStates[chatID] = &entities.UserState{}
-	return userStates[chatID]
 }
 
-func sendEnrollments(db *sql.DB, bot *tgbotapi.BotAPI, chatID int64) {
-	enrollments, err := storage.GetAllEnrollments(db)
+func (b *Bot) sendEnrollments(ctx context.Context, chatID int64) {
+	l := b.langFor(ctx, chatID)
+	enrollments, err := b.store.Enrollments.GetAllEnrollments(ctx)
 	if err != nil {
 		log.Printf("Ошибка при получении записей: %v", err)
-		bot.Send(tgbotapi.NewMessage(chatID, "Произошла ошибка при получении записей."))
+		b.send(chatID, l.T("enrollments.error"))
 		return
 	}
 
 	if len(enrollments) == 0 {
-		bot.Send(tgbotapi.NewMessage(chatID, "Записей пока нет."))
+		b.send(chatID, l.T("enrollments.empty"))
 		return
 	}
 
-	var b strings.Builder
-	b.WriteString("📋 Список записей:\n\n")
-	for i, e := range enrollments {
-		status := "❌ Не оплачено"
+	var sb strings.Builder
+	sb.WriteString(l.T("enrollments.header"))
+	for _, e := range enrollments {
+		status := l.T("enrollments.unpaid")
 		if e.IsPaid {
-			status = "✅ Оплачено"
+			status = l.T("enrollments.paid")
+			if e.ProviderChargeID != "" {
+				status = l.T("enrollments.paid_charge", e.ProviderChargeID)
+			}
+		}
+		if e.Canceled {
+			status = l.T("enrollments.canceled")
 		}
-		b.WriteString(fmt.Sprintf("%d) %s (Тел: %s) — %s — %s — %s (Баллы: %d)\n", i+1, e.Name, e.PhoneNumber, e.CourseName, status, e.Timestamp, e.TestScore))
+		sb.WriteString(l.N("enrollments.item", e.TestScore, e.ID, e.Name, e.PhoneNumber, e.CourseName, status, e.Timestamp, e.TestScore))
 	}
 
 	// Разбивка на части, если слишком длинно
-	const chunkSize = 4000
-	text := b.String()
-	for len(text) > 0 {
-		end := chunkSize
-		if len(text) < chunkSize {
-			end = len(text)
-		}
-		bot.Send(tgbotapi.NewMessage(chatID, text[:end]))
-		text = text[end:]
-	}
+	b.sendLong(chatID, sb.String())
 }
 
-func handleInitialStep(chatID int64, text string, state *entities.UserState, courses []entities.Course) tgbotapi.MessageConfig {
-	if state.Name == "" {
-		state.Name = text
-		state.Step = "name_entered"
-		return tgbotapi.NewMessage(chatID, "Спасибо! Теперь напишите 'Выбрать курс', чтобы выбрать курс.")
-	}
-	if strings.EqualFold(text, "Выбрать курс") {
-		var b strings.Builder
-		b.WriteString("Выберите курс:\n\n")
-		for i, course := range courses {
-			b.WriteString(fmt.Sprintf(
-				"%d) %s\nУровень: %s\nПреподаватель: %s\nВремя: %s\nОписание: %s\nЦена: %.2f₽\n\n",
-				i+1, course.Name, course.Level, course.Teacher, course.Schedule, course.Description, course.Price,
-			))
-		}
-		b.WriteString("Отправьте номер курса для выбора.")
-		state.Step = "waiting_for_course_selection"
-		return tgbotapi.NewMessage(chatID, b.String())
-	}
-
-	return tgbotapi.NewMessage(chatID, "Привет! Напишите 'Выбрать курс' чтобы выбрать курс.")
-}
+// Отложенная задача: напоминание об оплате курса, Payload — id курса.
+const jobPaymentReminder = "payment_reminder"
 
-func handleCourseSelection(chatID int64, text string, state *entities.UserState, courses []entities.Course) tgbotapi.MessageConfig {
-	courseNumber, err := parseCourseSelection(text)
-	if err == nil && courseNumber >= 1 && courseNumber <= len(courses) {
-		selectedCourse := &courses[courseNumber-1]
-		state.Selected = selectedCourse
-		state.Step = "waiting_for_payment_confirmation"
-		return tgbotapi.NewMessage(chatID, fmt.Sprintf(
-			"Вы выбрали курс: %s.\nЦена: %.2f₽\nХотите оплатить? Напишите 'Да' или 'Нет'.",
-			selectedCourse.Name, selectedCourse.Price,
-		))
+// schedulePaymentReminder заменяет прежнее напоминание о курсе новым.
+func (b *Bot) schedulePaymentReminder(ctx context.Context, chatID, courseID int64) {
+	b.cancelPaymentReminder(ctx, chatID, courseID)
+	if err := b.jobs.Schedule(ctx, jobPaymentReminder, chatID, strconv.FormatInt(courseID, 10), b.settings.PaymentReminderDelay); err != nil {
+		log.Printf("Ошибка при планировании напоминания: %v", err)
 	}
-
-	return tgbotapi.NewMessage(chatID, "Неверный номер курса. Пожалуйста, выберите курс по номеру.")
 }
 
-func handlePaymentConfirmation(chatID int64, text string, state *entities.UserState, bot *tgbotapi.BotAPI, botDB *sql.DB) tgbotapi.MessageConfig {
-	if strings.EqualFold(text, "Да") {
-		state.Step = "payment_successful" // Next step is to ask for questions
-		storage.SaveEnrollment(botDB, chatID, state.Name, state.PhoneNumber, state.Selected.Name, true, state.TestScore)
-		// Message will be sent by the "payment_successful" case
-		return tgbotapi.NewMessage(chatID, "Отлично! Ваш платеж был успешно принят. Спасибо за оплату!") // Placeholder, will be overridden
-	} else if strings.EqualFold(text, "Нет") {
-		state.Step = ""
-		storage.SaveEnrollment(botDB, chatID, state.Name, state.PhoneNumber, state.Selected.Name, false, state.TestScore)
-		go remindUserLater(bot, botDB, chatID, state.Selected.Name, 24*time.Hour) // Reminder after 24 hours
-		return tgbotapi.NewMessage(chatID, "Хорошо, подумайте еще. Напишите 'Выбрать курс', чтобы изменить выбор.")
+func (b *Bot) cancelPaymentReminder(ctx context.Context, chatID, courseID int64) {
+	if err := b.jobs.Cancel(ctx, jobPaymentReminder, chatID, strconv.FormatInt(courseID, 10)); err != nil {
+		log.Printf("Ошибка при отмене напоминания: %v", err)
 	}
-
-	return tgbotapi.NewMessage(chatID, "Пожалуйста, напишите 'Да' если вы оплатили, или 'Нет' если еще не оплатили.")
-}
-
-func parseCourseSelection(input string) (int, error) {
-	var number int
-	_, err := fmt.Sscanf(input, "%d", &number)
-	return number, err
 }
 
-func remindUserLater(bot *tgbotapi.BotAPI, db *sql.DB, chatID int64, courseName string, duration time.Duration) { // Added db and courseName parameters
-	time.Sleep(duration)
-
-	userState := getUserState(chatID)
+// sendPaymentReminder выполняет задачу jobPaymentReminder. Ошибка отправки
+// возвращается планировщику, чтобы тот повторил попытку.
+func (b *Bot) sendPaymentReminder(ctx context.Context, job entities.ScheduledJob) error {
+	chatID := job.ChatID
+	courseID, err := strconv.ParseInt(job.Payload, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid course id %q: %w", job.Payload, err)
+	}
+	course, ok := b.courseByID(courseID)
+	if !ok {
+		return nil // Курса больше нет — напоминать не о чем
+	}
+	userState, err := b.states.Get(ctx, chatID)
+	if err != nil {
+		return err
+	}
+	l := b.lang(userState)
+	courseName := course.Localized(l.Language()).Name
 	// Проверяем, оплатил ли пользователь курс за это время
-	enrollments, err := storage.GetEnrollmentsByUserIDAndCourse(db, chatID, courseName) // Use passed db and courseName
-	if err == nil && len(enrollments) > 0 && enrollments[0].IsPaid {
-		return // Пользователь уже оплатил
+	enrollments, err := b.store.Enrollments.GetEnrollmentsByUserIDAndCourse(ctx, chatID, courseID)
+	if err != nil {
+		return err
+	}
+	for _, e := range enrollments {
+		if e.IsPaid {
+			return nil // Пользователь уже оплатил
+		}
 	}
 
 	// Если курс все еще не оплачен или пользователь не выбрал новый
-	if userState.Selected != nil && userState.Selected.Name == courseName { // Check if the reminder is still for the same course
-		msgText := fmt.Sprintf("Напоминаем, что вы выбрали курс '%s', но еще не оплатили его. Напишите 'Выбрать курс', чтобы выбрать другой курс, или свяжитесь с нами для оплаты.", courseName)
-		msg := tgbotapi.NewMessage(chatID, msgText)
-		if _, err := bot.Send(msg); err != nil {
-			log.Printf("Error sending reminder: %v", err)
-		}
-	} else if userState.Step == "" || userState.Step == "waiting_for_course_selection" { // Generic reminder if no specific course context or user moved on
-		msg := tgbotapi.NewMessage(chatID, "Вы еще не выбрали курс или не завершили оплату. Напишите 'Выбрать курс' чтобы начать заново.")
-		if _, err := bot.Send(msg); err != nil {
-			log.Printf("Error sending reminder: %v", err)
-		}
+	if userState.Selected != nil && userState.Selected.ID == courseID { // Check if the reminder is still for the same course
+		_, err = b.msgr.SendKeyboard(chatID, l.T("reminder.course", courseName), b.chooseCourseKeyboard(userState))
+	} else if step := State(userState.Step); step == StateIdle || step == StateWaitingForCourse { // Generic reminder if no specific course context or user moved on
+		_, err = b.msgr.SendKeyboard(chatID, l.T("reminder.generic"), b.chooseCourseKeyboard(userState))
 	}
+	return err
 }
 
-func sendHistory(db *sql.DB, bot *tgbotapi.BotAPI, chatID int64) {
-	history, err := storage.GetConversationHistory(db, chatID)
+func (b *Bot) sendHistory(ctx context.Context, chatID int64) {
+	l := b.langFor(ctx, chatID)
+	history, err := b.store.Conversations.GetConversationHistory(ctx, chatID)
 	if err != nil {
 		log.Printf("Ошибка при получении истории: %v", err)
-		bot.Send(tgbotapi.NewMessage(chatID, "Произошла ошибка при получении истории."))
+		b.send(chatID, l.T("history.error"))
 		return
 	}
 
 	if len(history) == 0 {
-		bot.Send(tgbotapi.NewMessage(chatID, "Диалог пуст."))
+		b.send(chatID, l.T("history.empty"))
 		return
 	}
 
@@ -312,171 +554,51 @@ func sendHistory(db *sql.DB, bot *tgbotapi.BotAPI, chatID int64) {
 		builder.WriteString(fmt.Sprintf("[%s] %s: %s\n", msg.Timestamp, msg.Role, msg.Text))
 	}
 
-	const chunkSize = 4000
-	text := builder.String()
-	for len(text) > 0 {
-		end := chunkSize
-		if len(text) < chunkSize {
-			end = len(text)
-		}
-		bot.Send(tgbotapi.NewMessage(chatID, text[:end]))
-		text = text[end:]
-	}
+	b.sendLong(chatID, builder.String())
 }
 
-func sendCourses(bot *tgbotapi.BotAPI, chatID int64, courses []entities.Course) {
+func (b *Bot) sendCourses(chatID int64, us *entities.UserState) {
+	l := b.lang(us)
+	courses := b.courseList()
 	if len(courses) == 0 {
-		bot.Send(tgbotapi.NewMessage(chatID, "Курсы отсутствуют."))
+		b.send(chatID, l.T("courses.empty"))
 		return
 	}
 
-	var b strings.Builder
-	b.WriteString("📚 Доступные курсы:\n\n")
-	for i, course := range courses {
-		b.WriteString(fmt.Sprintf("%d) %s — %.2f₽\n", i+1, course.Name, course.Price))
+	var sb strings.Builder
+	sb.WriteString(l.T("courses.header"))
+	for _, course := range courses {
+		sb.WriteString(l.T("courses.item", course.ID, course.Localized(l.Language()).Name, course.Price))
 	}
-	bot.Send(tgbotapi.NewMessage(chatID, b.String()))
+	b.send(chatID, sb.String())
 }
 
-func sendTeachers(bot *tgbotapi.BotAPI, chatID int64, courses []entities.Course) {
+func (b *Bot) sendTeachers(chatID int64, us *entities.UserState) {
+	courses := b.courseList()
 	teachersMap := make(map[string]bool)
-	var b strings.Builder
-	b.WriteString("👨‍🏫 Преподаватели:\n\n")
+	var sb strings.Builder
+	sb.WriteString(b.lang(us).T("teachers.header"))
 	for _, course := range courses {
 		if !teachersMap[course.Teacher] {
-			b.WriteString(fmt.Sprintf("- %s\n", course.Teacher))
+			sb.WriteString(fmt.Sprintf("- %s\n", course.Teacher))
 			teachersMap[course.Teacher] = true
 		}
 	}
-	bot.Send(tgbotapi.NewMessage(chatID, b.String()))
+	b.send(chatID, sb.String())
 }
 
-func sendSchedules(bot *tgbotapi.BotAPI, chatID int64, courses []entities.Course) {
+func (b *Bot) sendSchedules(chatID int64, us *entities.UserState) {
+	l := b.lang(us)
+	courses := b.courseList()
 	if len(courses) == 0 {
-		bot.Send(tgbotapi.NewMessage(chatID, "Расписание отсутствует."))
+		b.send(chatID, l.T("schedule.empty"))
 		return
 	}
 
-	var b strings.Builder
-	b.WriteString("🗓 Расписание курсов:\n\n")
+	var sb strings.Builder
+	sb.WriteString(l.T("schedule.header"))
 	for _, course := range courses {
-		b.WriteString(fmt.Sprintf("- %s: %s\n", course.Name, course.Schedule))
-	}
-	bot.Send(tgbotapi.NewMessage(chatID, b.String()))
-}
-
-func sendTestQuestion(bot *tgbotapi.BotAPI, chatID int64, index int) {
-	q := testQuestions[index]
-	var b strings.Builder
-	b.WriteString(fmt.Sprintf("❓ %s\n", q.Question))
-	for i, option := range q.Options {
-		b.WriteString(fmt.Sprintf("%d) %s\n", i+1, option))
-	}
-	bot.Send(tgbotapi.NewMessage(chatID, b.String()))
-}
-
-func handleTestStep(bot *tgbotapi.BotAPI, db *sql.DB, chatID int64, userAnswer string, state *entities.UserState, courses []entities.Course) { // Corrected tgbotapi typo
-	answerIndex := -1
-	_, err := fmt.Sscanf(userAnswer, "%d", &answerIndex)
-
-	// Проверка: введено не число или не от 1 до 4
-	if err != nil || answerIndex < 1 || answerIndex > 4 {
-		msg := tgbotapi.NewMessage(chatID, "Пожалуйста, введите число от 1 до 4.")
-		bot.Send(msg)
-		// Повторить текущий вопрос
-		sendTestQuestion(bot, chatID, state.TestIndex)
-		return
-	}
-
-	// Проверка ответа
-	if answerIndex-1 == testQuestions[state.TestIndex].Answer {
-		state.TestScore++
-	}
-
-	state.TestIndex++
-
-	if state.TestIndex >= len(testQuestions) {
-		state.IsTakingTest = false
-		// state.Step = "" // Step will be set after recommendations
-		bot.Send(tgbotapi.NewMessage(chatID, fmt.Sprintf("✅ Тест завершён! Вы набрали %d из %d баллов.", state.TestScore, len(testQuestions))))
-		sendRecommendedCourses(bot, db, chatID, state.TestScore)
-
-		// Немного подождать перед следующим шагом
-		time.Sleep(2 * time.Second)
-
-		// Перевести пользователя к выбору курса
-		// The user will be prompted to select a course after recommendations or if they skip questions.
-		// For now, setting step to allow course selection flow to continue.
-		// The actual message for course selection will be triggered by handleInitialStep or similar logic
-		// based on the new state.Step value.
-		state.Step = "waiting_for_course_selection"                      // Ensure this step allows course selection flow
-		msg := handleInitialStep(chatID, "Выбрать курс", state, courses) // This will generate the course list
-		bot.Send(msg)
-		return
-	}
-
-	// Следующий вопрос
-	sendTestQuestion(bot, chatID, state.TestIndex)
-}
-
-func sendRecommendedCourses(bot *tgbotapi.BotAPI, db *sql.DB, chatID int64, score int) {
-	var level string
-	if score <= 3 {
-		level = "Начальный"
-	} else if score <= 7 {
-		level = "Средний"
-	} else {
-		level = "Продвинутый"
-	}
-
-	courses, _ := storage.GetCourses(db) // если нужно — передай подключение
-
-	var b strings.Builder
-	b.WriteString(fmt.Sprintf("📚 Курсы уровня \"%s\":\n\n", level))
-	i := 1
-	for _, course := range courses {
-		if strings.EqualFold(course.Level, level) {
-			b.WriteString(fmt.Sprintf("%d) %s — %.2f₽\n", i, course.Name, course.Price))
-			i++
-		}
-	}
-
-	if i == 1 {
-		b.WriteString("Нет доступных курсов для этого уровня.")
-	}
-
-	bot.Send(tgbotapi.NewMessage(chatID, b.String()))
-}
-
-func sendUserQuestions(db *sql.DB, bot *tgbotapi.BotAPI, chatID int64) {
-	questions, err := storage.GetAllUserQuestions(db)
-	if err != nil {
-		log.Printf("Ошибка при получении вопросов пользователей: %v", err)
-		bot.Send(tgbotapi.NewMessage(chatID, "Произошла ошибка при получении вопросов пользователей."))
-		return
-	}
-
-	if len(questions) == 0 {
-		bot.Send(tgbotapi.NewMessage(chatID, "Вопросов пока нет."))
-		return
-	}
-
-	var b strings.Builder
-	b.WriteString("❓ Список вопросов от пользователей:\n\n")
-	for i, q := range questions {
-		// Use q.Name and q.PhoneNumber directly as they are now stored with the question
-		b.WriteString(fmt.Sprintf("%d) Имя: %s\n   Телефон: %s\n   Вопрос: %s\n   Время: %s\n\n", i+1, q.Name, q.PhoneNumber, q.QuestionText, q.Timestamp))
-	}
-
-	// Разбивка на части, если слишком длинно
-	const chunkSize = 4000
-	text := b.String()
-	for len(text) > 0 {
-		end := chunkSize
-		if len(text) < chunkSize {
-			end = len(text)
-		}
-		bot.Send(tgbotapi.NewMessage(chatID, text[:end]))
-		text = text[end:]
+		sb.WriteString(fmt.Sprintf("- %s: %s\n", course.Localized(l.Language()).Name, course.Schedule))
 	}
+	b.send(chatID, sb.String())
 }
@@ -0,0 +1,285 @@
+package tgbot
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+
+	"tgbot/internal/entities"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+const StateWaitlistAsk State = "waitlist_prompt"
+
+// Отложенная задача: истечение предложения места, Payload — id записи в очереди.
+const jobSeatOfferExpire = "seat_offer_expire"
+
+// Кнопка «Записаться» в предложении места. Работает из любого шага диалога.
+const seatOfferPrefix = "seatoffer:"
+
+// freeSeats возвращает число мест, которые можно занять прямо сейчас:
+// вместимость минус оплаченные записи и места, придержанные по предложениям.
+func (b *Bot) freeSeats(ctx context.Context, course entities.Course) (int, error) {
+	if course.Capacity == 0 {
+		return math.MaxInt, nil
+	}
+	paid, err := b.store.Enrollments.CountPaidEnrollments(ctx, course.ID)
+	if err != nil {
+		return 0, err
+	}
+	offers, err := b.store.Waitlist.CountActiveOffers(ctx, course.ID, b.jobs.Now())
+	if err != nil {
+		return 0, err
+	}
+	return course.Capacity - paid - offers, nil
+}
+
+// seatAvailable сообщает, может ли userID записаться на курс: есть свободное
+// место или для него придержано место из листа ожидания.
+func (b *Bot) seatAvailable(ctx context.Context, userID int64, course entities.Course) (bool, error) {
+	if course.Capacity == 0 {
+		return true, nil
+	}
+	offer, err := b.store.Waitlist.ActiveOffer(ctx, userID, course.ID, b.jobs.Now())
+	if err != nil {
+		return false, err
+	}
+	if offer != nil {
+		return true, nil
+	}
+	free, err := b.freeSeats(ctx, course)
+	return free > 0, err
+}
+
+func (b *Bot) enterWaitlistPrompt(ctx context.Context, chatID int64, us *entities.UserState) {
+	l := b.lang(us)
+	b.replyKeyboard(ctx, chatID, l.T("waitlist.prompt", b.localCourse(l, *us.Selected).Name), b.yesNoKeyboard(us))
+}
+
+func (b *Bot) handleWaitlistPrompt(ctx context.Context, in input, us *entities.UserState) State {
+	l := b.lang(us)
+	switch {
+	case b.isChoice(us, in.text, choiceYes):
+		entry, err := b.store.Waitlist.AddToWaitlist(ctx, in.chatID, us.Selected.ID, b.jobs.Now())
+		if err != nil {
+			log.Printf("Ошибка при добавлении в лист ожидания: %v", err)
+			b.reply(ctx, in.chatID, l.T("waitlist.add_error"))
+			return StateIdle
+		}
+		courseName := b.courseName(l, entry.CourseID, entry.CourseName)
+		if entry.Status == entities.WaitlistOffered {
+			b.reply(ctx, in.chatID, l.T("waitlist.already_offered", courseName))
+			return StateIdle
+		}
+		b.reply(ctx, in.chatID, l.T("waitlist.added", courseName, entry.Position))
+		return StateIdle
+
+	case b.isChoice(us, in.text, choiceNo):
+		b.replyKeyboard(ctx, in.chatID, l.T("waitlist.declined"), b.chooseCourseKeyboard(us))
+		return StateIdle
+	}
+
+	b.replyKeyboard(ctx, in.chatID, l.T("common.yes_no"), b.yesNoKeyboard(us))
+	return StateWaitlistAsk
+}
+
+// offerFreeSeats предлагает свободные места курса первым в очереди.
+// Вызывается, когда место освобождается или увеличивается вместимость.
+func (b *Bot) offerFreeSeats(ctx context.Context, courseID int64) {
+	course, ok := b.courseByID(courseID)
+	if !ok {
+		return
+	}
+	for {
+		free, err := b.freeSeats(ctx, course)
+		if err != nil {
+			log.Printf("Ошибка при подсчёте мест на курсе %d: %v", courseID, err)
+			return
+		}
+		if free <= 0 {
+			return
+		}
+
+		entry, err := b.store.Waitlist.NextWaiting(ctx, courseID)
+		if err != nil {
+			log.Printf("Ошибка при чтении листа ожидания курса %d: %v", courseID, err)
+			return
+		}
+		if entry == nil {
+			return
+		}
+		if err := b.offerSeat(ctx, *entry); err != nil {
+			log.Printf("Ошибка при предложении места (очередь %d): %v", entry.ID, err)
+			return
+		}
+	}
+}
+
+func (b *Bot) offerSeat(ctx context.Context, entry entities.WaitlistEntry) error {
+	now := b.jobs.Now()
+	ttl := b.settings.SeatOfferTTL
+	expiresAt := now.Add(ttl)
+	if err := b.store.Waitlist.OfferSeat(ctx, entry.ID, expiresAt, now); err != nil {
+		return err
+	}
+	if err := b.jobs.Schedule(ctx, jobSeatOfferExpire, entry.UserID, strconv.FormatInt(entry.ID, 10), ttl); err != nil {
+		log.Printf("Ошибка при планировании истечения предложения %d: %v", entry.ID, err)
+	}
+
+	l := b.langFor(ctx, entry.UserID)
+	text := l.T("waitlist.offer", b.courseName(l, entry.CourseID, entry.CourseName), expiresAt.Local().Format("02.01.2006 15:04"))
+	keyboard := columnKeyboard(tgbotapi.NewInlineKeyboardButtonData(l.T("waitlist.enroll"), seatOfferPrefix+strconv.FormatInt(entry.ID, 10)))
+	if _, err := b.msgr.SendKeyboard(entry.UserID, text, keyboard); err != nil {
+		log.Printf("Ошибка при отправке предложения места в чат %d: %v", entry.UserID, err)
+	}
+	return nil
+}
+
+// expireSeatOffer выполняет задачу jobSeatOfferExpire: неиспользованное место
+// переходит к следующему в очереди.
+func (b *Bot) expireSeatOffer(ctx context.Context, job entities.ScheduledJob) error {
+	id, err := strconv.ParseInt(job.Payload, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid waitlist id %q: %w", job.Payload, err)
+	}
+	entry, err := b.store.Waitlist.GetWaitlistEntry(ctx, id)
+	if err != nil {
+		return err
+	}
+	if entry == nil || entry.Status != entities.WaitlistOffered {
+		return nil // Место уже оплачено
+	}
+
+	if err := b.store.Waitlist.SetWaitlistStatus(ctx, id, entities.WaitlistExpired, b.jobs.Now()); err != nil {
+		return err
+	}
+	l := b.langFor(ctx, entry.UserID)
+	b.send(entry.UserID, l.T("waitlist.offer_expired", b.courseName(l, entry.CourseID, entry.CourseName)))
+	b.offerFreeSeats(ctx, entry.CourseID)
+	return nil
+}
+
+// handleSeatOffer открывает оплату курса по кнопке из предложения места.
+func (b *Bot) handleSeatOffer(ctx context.Context, cq *tgbotapi.CallbackQuery, payload string) {
+	chatID := cq.Message.Chat.ID
+	id, _ := strconv.ParseInt(payload, 10, 64)
+	entry, err := b.store.Waitlist.GetWaitlistEntry(ctx, id)
+	if err != nil {
+		log.Printf("Ошибка при чтении листа ожидания: %v", err)
+	}
+	userState, err := b.states.Get(ctx, chatID)
+	if err != nil {
+		log.Printf("Ошибка при загрузке состояния пользователя: %v", err)
+		b.answerCallback(cq.ID, b.lang(&entities.UserState{}).T("common.try_later"))
+		return
+	}
+	l := b.lang(userState)
+	if entry == nil || entry.UserID != chatID || entry.Status != entities.WaitlistOffered || !b.jobs.Now().Before(entry.OfferExpiresAt) {
+		b.answerCallback(cq.ID, l.T("waitlist.offer_invalid"))
+		return
+	}
+	course, ok := b.courseByID(entry.CourseID)
+	if !ok {
+		b.answerCallback(cq.ID, l.T("course.unavailable"))
+		return
+	}
+	b.answerCallback(cq.ID, "")
+	defer b.states.Save(ctx, chatID, userState)
+
+	userState.Selected = &course
+	if err := conversation.Jump(b, ctx, chatID, userState, StateWaitingForPayment); err != nil {
+		log.Printf("Ошибка перехода к оплате по предложению места: %v", err)
+	}
+}
+
+// completeSeatOffer закрывает предложение места после оплаты курса.
+func (b *Bot) completeSeatOffer(ctx context.Context, userID, courseID int64) {
+	now := b.jobs.Now()
+	offer, err := b.store.Waitlist.ActiveOffer(ctx, userID, courseID, now)
+	if err != nil {
+		log.Printf("Ошибка при чтении листа ожидания: %v", err)
+		return
+	}
+	if offer == nil {
+		return
+	}
+	if err := b.store.Waitlist.SetWaitlistStatus(ctx, offer.ID, entities.WaitlistEnrolled, now); err != nil {
+		log.Printf("Ошибка при обновлении листа ожидания: %v", err)
+	}
+}
+
+// sendWaitlist показывает пользователю его места в очередях.
+func (b *Bot) sendWaitlist(ctx context.Context, chatID int64) {
+	l := b.langFor(ctx, chatID)
+	entries, err := b.store.Waitlist.GetUserWaitlist(ctx, chatID, b.jobs.Now())
+	if err != nil {
+		log.Printf("Ошибка при получении листа ожидания: %v", err)
+		b.send(chatID, l.T("waitlist.error"))
+		return
+	}
+
+	if len(entries) == 0 {
+		b.send(chatID, l.T("waitlist.empty"))
+		return
+	}
+
+	var sb strings.Builder
+	sb.WriteString(l.T("waitlist.header"))
+	var buttons []tgbotapi.InlineKeyboardButton
+	for _, e := range entries {
+		courseName := b.courseName(l, e.CourseID, e.CourseName)
+		if e.Status == entities.WaitlistOffered {
+			sb.WriteString(l.T("waitlist.item_offered", courseName, e.OfferExpiresAt.Local().Format("02.01.2006 15:04")))
+			buttons = append(buttons, tgbotapi.NewInlineKeyboardButtonData(l.T("waitlist.enroll_course", courseName), seatOfferPrefix+strconv.FormatInt(e.ID, 10)))
+			continue
+		}
+		sb.WriteString(l.T("waitlist.item", courseName, e.Position))
+	}
+
+	if len(buttons) == 0 {
+		b.send(chatID, sb.String())
+		return
+	}
+	if _, err := b.msgr.SendKeyboard(chatID, sb.String(), columnKeyboard(buttons...)); err != nil {
+		log.Printf("Ошибка при отправке сообщения в чат %d: %v", chatID, err)
+	}
+}
+
+// cancelEnrollment отменяет запись по команде сотрудника
+// «/cancelenrollment <id>» и предлагает место следующему в очереди.
+func (b *Bot) cancelEnrollment(ctx context.Context, chatID int64, args string) {
+	l := b.langFor(ctx, chatID)
+	id, err := strconv.ParseInt(args, 10, 64)
+	if err != nil {
+		b.send(chatID, l.T("cancelenrollment.usage"))
+		return
+	}
+	enrollment, err := b.store.Enrollments.GetEnrollment(ctx, id)
+	if err != nil {
+		log.Printf("Ошибка при получении записи %d: %v", id, err)
+		b.send(chatID, l.T("cancelenrollment.error"))
+		return
+	}
+	if enrollment == nil || enrollment.Canceled {
+		b.send(chatID, l.T("cancelenrollment.not_found"))
+		return
+	}
+
+	if err := b.store.Enrollments.CancelEnrollment(ctx, id); err != nil {
+		log.Printf("Ошибка при отмене записи %d: %v", id, err)
+		b.send(chatID, l.T("cancelenrollment.failed"))
+		return
+	}
+	b.cancelPaymentReminder(ctx, enrollment.UserID, enrollment.CourseID)
+
+	b.send(chatID, l.T("cancelenrollment.done", id, enrollment.Name, enrollment.CourseName))
+	userLang := b.langFor(ctx, enrollment.UserID)
+	b.send(enrollment.UserID, userLang.T("cancelenrollment.user_notice", b.courseName(userLang, enrollment.CourseID, enrollment.CourseName)))
+	if enrollment.IsPaid {
+		b.offerFreeSeats(ctx, enrollment.CourseID)
+	}
+}
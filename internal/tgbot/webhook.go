@@ -0,0 +1,138 @@
+package tgbot
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+// Заголовок, в котором Telegram присылает secret_token из setWebhook.
+const webhookSecretHeader = "X-Telegram-Bot-Api-Secret-Token"
+
+// WebhookOptions настраивает приём обновлений через webhook.
+type WebhookOptions struct {
+	// Listen — адрес HTTP-сервера, например ":8080". TLS завершается на прокси.
+	Listen string
+	// Secret сверяется с заголовком X-Telegram-Bot-Api-Secret-Token и задаёт путь.
+	Secret string
+	// URL — публичный адрес сервера. Если задан, бот сам вызывает setWebhook,
+	// иначе webhook должен быть зарегистрирован заранее.
+	URL string
+}
+
+// WebhookPath возвращает секретный путь webhook. Путь выводится из Secret,
+// а не совпадает с ним, чтобы сам секрет не попадал в логи прокси.
+func WebhookPath(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return "/webhook/" + hex.EncodeToString(sum[:16])
+}
+
+// WebhookHandler принимает обновления от Telegram и передаёт их в updates.
+type WebhookHandler struct {
+	secret  string
+	updates chan<- tgbotapi.Update
+}
+
+func NewWebhookHandler(secret string, updates chan<- tgbotapi.Update) *WebhookHandler {
+	return &WebhookHandler{secret: secret, updates: updates}
+}
+
+func (h *WebhookHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if subtle.ConstantTimeCompare([]byte(r.Header.Get(webhookSecretHeader)), []byte(h.secret)) != 1 {
+		log.Printf("Webhook: запрос с неверным секретом от %s", r.RemoteAddr)
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+
+	var update tgbotapi.Update
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&update); err != nil {
+		log.Printf("Webhook: некорректное обновление: %v", err)
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+
+	// Пока очередь занята, Telegram ждёт ответа и не шлёт следующие обновления
+	select {
+	case h.updates <- update:
+		w.WriteHeader(http.StatusOK)
+	case <-r.Context().Done():
+		// Бот останавливается: без 200 Telegram повторит обновление позже
+		http.Error(w, "shutting down", http.StatusServiceUnavailable)
+	}
+}
+
+// listenWebhook открывает порт, запускает HTTP-сервер и при необходимости
+// регистрирует webhook в Telegram. Ошибка открытия порта возвращается сразу,
+// а ошибка работы сервера приходит в канал ошибок. Запросы, ожидающие места
+// в очереди, отменяются вместе с ctx; возвращаемая функция останавливает
+// сервер, ожидая незавершённые запросы не дольше shutdownTimeout.
+func listenWebhook(ctx context.Context, api *tgbotapi.BotAPI, opts WebhookOptions, shutdownTimeout time.Duration) (<-chan tgbotapi.Update, <-chan error, func(), error) {
+	if opts.Secret == "" {
+		return nil, nil, nil, fmt.Errorf("webhook secret is required")
+	}
+	path := WebhookPath(opts.Secret)
+
+	// Порт открываем до setWebhook, чтобы не направить Telegram на сервер,
+	// который не смог запуститься
+	ln, err := net.Listen("tcp", opts.Listen)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("webhook listen on %s: %w", opts.Listen, err)
+	}
+	if opts.URL != "" {
+		if err := setWebhook(api, strings.TrimSuffix(opts.URL, "/")+path, opts.Secret); err != nil {
+			ln.Close()
+			return nil, nil, nil, fmt.Errorf("failed to set webhook: %w", err)
+		}
+	}
+
+	updates := make(chan tgbotapi.Update, api.Buffer)
+	mux := http.NewServeMux()
+	mux.Handle(path, NewWebhookHandler(opts.Secret, updates))
+	srv := &http.Server{
+		Handler:     mux,
+		BaseContext: func(net.Listener) context.Context { return ctx },
+	}
+	errs := make(chan error, 1)
+	go func() {
+		log.Printf("Webhook слушает %s%s", ln.Addr(), path)
+		if err := srv.Serve(ln); err != nil && err != http.ErrServerClosed {
+			errs <- err
+		}
+	}()
+
+	stop := func() {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			log.Printf("Ошибка при остановке webhook-сервера: %v", err)
+		}
+	}
+	return updates, errs, stop, nil
+}
+
+// setWebhook регистрирует webhook с secret_token. tgbotapi.WebhookConfig не
+// умеет передавать secret_token, поэтому запрос собирается вручную.
+func setWebhook(api *tgbotapi.BotAPI, webhookURL, secret string) error {
+	params := url.Values{}
+	params.Set("url", webhookURL)
+	params.Set("secret_token", secret)
+	params.Set("allowed_updates", `["message","callback_query","pre_checkout_query"]`)
+	_, err := api.MakeRequest("setWebhook", params)
+	return err
+}
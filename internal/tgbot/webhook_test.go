@@ -0,0 +1,73 @@
+package tgbot
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+func TestWebhookHandlerChecksSecret(t *testing.T) {
+	const secret = "s3cret"
+	updates := make(chan tgbotapi.Update, 1)
+	srv := httptest.NewServer(NewWebhookHandler(secret, updates))
+	defer srv.Close()
+
+	post := func(header string) int {
+		t.Helper()
+		req, err := http.NewRequest(http.MethodPost, srv.URL, strings.NewReader(`{"update_id": 7, "message": {"text": "hi"}}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if header != "" {
+			req.Header.Set(webhookSecretHeader, header)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	if code := post(""); code != http.StatusForbidden {
+		t.Fatalf("без секрета: %d", code)
+	}
+	if code := post("wrong"); code != http.StatusForbidden {
+		t.Fatalf("с неверным секретом: %d", code)
+	}
+	if len(updates) != 0 {
+		t.Fatal("обновление с неверным секретом попало в очередь")
+	}
+
+	if code := post(secret); code != http.StatusOK {
+		t.Fatalf("с верным секретом: %d", code)
+	}
+	select {
+	case update := <-updates:
+		if update.UpdateID != 7 || update.Message == nil || update.Message.Text != "hi" {
+			t.Fatalf("обновление: %+v", update)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("обновление не попало в очередь")
+	}
+}
+
+func TestListenWebhookReturnsBindError(t *testing.T) {
+	busy, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer busy.Close()
+
+	api := &tgbotapi.BotAPI{Buffer: 1}
+	_, _, _, err = listenWebhook(context.Background(), api, WebhookOptions{Listen: busy.Addr().String(), Secret: "s"}, time.Second)
+	if err == nil {
+		t.Fatal("занятый порт не вернул ошибку")
+	}
+}